@@ -3,16 +3,21 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/nais/elector/pkg/election"
+	"github.com/nais/elector/pkg/election/backend"
 	"github.com/nais/elector/pkg/election/candidate"
 	"github.com/nais/elector/pkg/election/official"
 	"github.com/nais/elector/pkg/logging"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -24,8 +29,10 @@ import (
 	log "github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
@@ -49,8 +56,53 @@ const (
 	MetricsAddress    = "metrics-address"
 	ProbeAddress      = "probe-address"
 	ElectionAddress   = "http"
+	GRPCAddress       = "grpc"
+	MaxSubscribers    = "max-subscribers"
 	ElectionName      = "election"
 	ElectionNamespace = "election-namespace"
+	PodNamespace      = "pod-namespace"
+	Identity          = "identity"
+	ElectionMode      = "election-mode"
+	Backend           = "backend"
+	LockDir           = "lock-dir"
+	EtcdEndpoints     = "etcd-endpoints"
+	EtcdPrefix        = "etcd-prefix"
+	LeaseDuration     = "lease-duration"
+	RenewInterval     = "renew-interval"
+	ReleaseOnShutdown = "release-on-shutdown"
+	SuccessorTimeout  = "successor-timeout"
+	Priority          = "priority"
+	PriorityBackoff   = "priority-backoff"
+	Preemption        = "preemption"
+	CampaignJitter    = "campaign-jitter"
+	RetryBackoff      = "retry-backoff"
+	RetryBackoffMax   = "retry-backoff-max"
+	ResyncPeriod      = "resync-period"
+	RequireReady      = "require-ready"
+	EligibleSelector  = "eligible-selector"
+	ContainerName     = "container-name"
+	PreferredTopology = "preferred-topology"
+	TopologyBackoff   = "topology-backoff"
+	Rebalance         = "rebalance"
+	MinTenure         = "min-tenure"
+	TransitionLimit   = "transition-limit"
+	TransitionWindow  = "transition-window"
+	Leaders           = "leaders"
+	PinConfigMap      = "pin-configmap"
+	Observer          = "observer"
+
+	EvictNotReadyAfter        = "evict-not-ready-after"
+	EvictRestartingAfter      = "evict-restarting-after"
+	EvictRestartingContainers = "evict-restarting-containers"
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+const (
+	BackendLease     = "lease"
+	BackendConfigMap = "configmap"
+	BackendEtcd      = "etcd"
+	BackendFile      = "file"
 )
 
 const (
@@ -69,17 +121,57 @@ func init() {
 	flag.String(MetricsAddress, "0.0.0.0:29090", "The address the metric endpoint binds to.")
 	flag.String(ProbeAddress, "0.0.0.0:28080", "The address the probe endpoints binds to.")
 	flag.String(ElectionAddress, "0.0.0.0:27070", "The address the election endpoints binds to.")
-	flag.String(ElectionName, "", "The election name to take part in.")
+	flag.String(GRPCAddress, "", "The address the gRPC election service binds to. Empty disables gRPC.")
+	flag.Int(MaxSubscribers, 10000, "The most clients that can stream or wait for the results of each election at once. Zero means no limit.")
+	flag.StringSlice(ElectionName, nil, "The names of the elections to take part in, separated by commas. The first election is also served on the top level endpoints.")
 	flag.String(ElectionNamespace, "", "The namespace the election is run in.")
+	flag.String(Identity, "", "Identity of this candidate, and the name of its Pod. Default is the POD_NAME environment variable, or the hostname.")
+	flag.String(PodNamespace, "", "The namespace of this Pod. Default is the POD_NAMESPACE environment variable, or the service account namespace.")
+	flag.Bool(Observer, false, "Only report the leader of the elections, never campaign.")
+	flag.Int(Leaders, 1, "Number of leaders in each election. With more than one, each leader holds a numbered Lease named <election>-<slot>.")
+	flag.String(Backend, BackendLease, "Where the lock is stored, either \"lease\", \"configmap\", \"etcd\" or \"file\". The file backend runs without Kubernetes.")
+	flag.StringSlice(EtcdEndpoints, nil, "Endpoints of the etcd cluster, when using the etcd backend.")
+	flag.String(EtcdPrefix, "/elector", "Prefix of the etcd keys, when using the etcd backend.")
+	flag.String(LockDir, filepath.Join(os.TempDir(), "elector"), "Directory shared by the candidates for lock files, when using the file backend.")
+	flag.String(ElectionMode, string(candidate.ModeOwnerReference), "How leadership is kept, either \"owner-reference\" or \"renewing\".")
+	flag.Duration(LeaseDuration, 15*time.Second, "How long a Lease is valid after it was last renewed, when using renewing mode. Also the TTL of keys in the etcd backend.")
+	flag.Duration(RenewInterval, 5*time.Second, "How often the leader renews its Lease, when using renewing mode.")
+	flag.Bool(ReleaseOnShutdown, true, "Release leadership when receiving SIGTERM or when the Pod is being deleted.")
+	flag.Duration(SuccessorTimeout, 0, "How long to wait for a new leader after releasing leadership. Zero means don't wait.")
+	flag.Int(Priority, 0, fmt.Sprintf("Priority of this candidate, between 0 and %d. Can be overridden with the %s Pod annotation.", candidate.MaxPriority, candidate.AnnotationPriority))
+	flag.Duration(PriorityBackoff, 0, "How long to wait before campaigning for each priority level below the maximum. Zero disables the backoff.")
+	flag.Duration(CampaignJitter, 0, "Wait up to this long, at random, before campaigning, so that candidates don't all campaign at once.")
+	flag.Duration(RetryBackoff, time.Second, "How long to wait before checking the election again after an error. Doubles for each consecutive error. Zero keeps the controller-runtime default.")
+	flag.Duration(RetryBackoffMax, 2*time.Minute, "The longest to wait before checking the election again after errors.")
+	flag.Duration(ResyncPeriod, time.Minute, "How often to check the election, in addition to when the Lease or Pods change. Zero disables.")
+	flag.Bool(Preemption, false, "Ask the leader to step down when this candidate is ready and has a higher priority.")
+	flag.Bool(RequireReady, false, "Only campaign when all other containers in the Pod are ready, and step down as leader when they are not.")
+	flag.String(EligibleSelector, "", "Label selector the Pod must match to campaign.")
+	flag.String(PreferredTopology, "", "Label selector for the Nodes leaders should run on, such as topology.kubernetes.io/zone=europe-north1-a.")
+	flag.Duration(TopologyBackoff, 5*time.Second, "How long candidates outside the preferred topology wait before campaigning.")
+	flag.Bool(Rebalance, false, "Ask a leader outside the preferred topology to step down when a candidate in it is ready.")
+	flag.Duration(MinTenure, 0, "How long a leader holds leadership before stepping down voluntarily or being evicted. Zero disables.")
+	flag.Int(TransitionLimit, 0, "Freeze the election when leadership changes hands more than this many times within --transition-window. Zero disables.")
+	flag.Duration(TransitionWindow, 10*time.Minute, "The window in which leadership changes are counted towards --transition-limit.")
+	flag.String(ContainerName, "elector", "Name of the elector container, which is ignored when checking readiness.")
+	flag.String(PinConfigMap, "", fmt.Sprintf("Name of a ConfigMap in the election namespace where the %s annotation pins leadership to a Pod.", candidate.AnnotationPinnedHolder))
+	flag.Duration(EvictNotReadyAfter, 0, "Evict a leader that has been NotReady for this long. Zero disables.")
+	flag.Duration(EvictRestartingAfter, 0, "Evict a leader that has had containers restarting for this long. Zero disables.")
+	flag.StringSlice(EvictRestartingContainers, nil, "Containers to watch for restarts when evicting leaders. Default is all containers.")
 	flag.String(LogFormat, "text", "Log format, either \"text\" or \"json\"")
 	flag.String(LogLevel, "info", logLevelHelp())
 
-	flag.Parse()
-
 	err := viper.BindPFlags(flag.CommandLine)
 	if err != nil {
 		panic(err)
 	}
+
+	// The simulation options are parsed along with the candidate options, but only by the simulate command,
+	// and they are added after binding so that they can't be set through the environment.
+	if simulating() {
+		flag.CommandLine.AddFlagSet(simulateFlags())
+	}
+	flag.Parse()
 }
 
 func logLevelHelp() string {
@@ -115,27 +207,56 @@ func formatter(logFormat string) (log.Formatter, error) {
 func main() {
 	logger := configureLogging()
 
-	electionName := types.NamespacedName{
-		Namespace: viper.GetString(ElectionNamespace),
-		Name:      viper.GetString(ElectionName),
+	if simulating() {
+		os.Exit(simulate(logger))
+	}
+
+	electionNamespace := viper.GetString(ElectionNamespace)
+	electionNames, err := electionNames()
+	if err != nil {
+		logger.Error(err)
+		os.Exit(ExitConfig)
 	}
 
-	if electionName.Name == "" || electionName.Namespace == "" {
+	if len(electionNames) == 0 || electionNamespace == "" {
 		logger.Error(fmt.Errorf("both --election and --election-namespace are required options (sic)"))
 		os.Exit(ExitConfig)
 	}
 
-	logger = logger.WithFields(log.Fields{
-		"election_name": electionName.String(),
-	})
+	if viper.GetInt(Leaders) < 1 {
+		logger.Error(fmt.Errorf("--%s must be at least 1", Leaders))
+		os.Exit(ExitConfig)
+	}
+
+	if viper.GetInt(MaxSubscribers) < 0 {
+		logger.Error(fmt.Errorf("--%s can't be negative", MaxSubscribers))
+		os.Exit(ExitConfig)
+	}
+
+	config, err := candidateConfig()
+	if err != nil {
+		logger.Error(err)
+		os.Exit(ExitConfig)
+	}
+	config.PodNamespace = podNamespace(electionNamespace)
+	if config.PodNamespace != electionNamespace {
+		logger.Infof("running in namespace %s, elections in namespace %s", config.PodNamespace, electionNamespace)
+	}
 
 	ctrl.SetLogger(logr.New(&logrus2logr.Logrus2Logr{Logger: logger.WithField(logging.FieldComponent, "controller-runtime")}))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig, err := restConfig()
+	if err != nil {
+		logger.Error(fmt.Errorf("unable to get Kubernetes config: %w", err))
+		os.Exit(ExitManagerCreation)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme: scheme,
 		Cache: cache.Options{
 			DefaultNamespaces: map[string]cache.Config{
-				electionName.Namespace: {},
+				electionNamespace:   {},
+				config.PodNamespace: {},
 			},
 		},
 		Metrics: server.Options{
@@ -149,6 +270,12 @@ func main() {
 		logger.Error(fmt.Errorf("failed to start controller-runtime manager: %w", err))
 		os.Exit(ExitManagerCreation)
 	}
+	config.Backend, err = newBackend(mgr)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(ExitConfig)
+	}
+
 	err = mgr.AddHealthzCheck("manager", healthz.Ping)
 	if err != nil {
 		logger.Error(fmt.Errorf("failed to add default liveness: %w", err))
@@ -157,15 +284,35 @@ func main() {
 
 	logger.Info("elector starting")
 	terminator := context.Background()
-	electionResults := make(chan string)
+	candidates := make([]*candidate.Candidate, 0, len(electionNames))
+	elections := make([]official.Election, 0, len(electionNames))
 
-	err = candidate.AddCandidateToManager(mgr, logger, electionResults, electionName)
-	if err != nil {
-		logger.Error(err)
-		os.Exit(ExitCandidateAdded)
+	for _, name := range electionNames {
+		electionName := types.NamespacedName{
+			Namespace: electionNamespace,
+			Name:      name,
+		}
+		electionResults := make(chan election.Result)
+		electionLogger := logger.WithFields(log.Fields{
+			"election_name": electionName.String(),
+		})
+
+		electionCandidates, err := addCandidates(mgr, electionLogger, electionResults, electionName, config)
+		if err != nil {
+			logger.Error(err)
+			os.Exit(ExitCandidateAdded)
+		}
+		candidates = append(candidates, electionCandidates...)
+		elections = append(elections, official.Election{
+			Name:    name,
+			Results: electionResults,
+		})
 	}
 
-	err = official.AddOfficialToManager(mgr, logger, electionResults, viper.GetString(ElectionAddress))
+	handlers := map[string]http.HandlerFunc{
+		"/prestop": candidate.PreStopHandler(logger, candidates),
+	}
+	err = official.AddOfficialToManager(mgr, logger, elections, viper.GetString(ElectionAddress), viper.GetString(GRPCAddress), viper.GetInt(MaxSubscribers), handlers)
 	if err != nil {
 		logger.Error(fmt.Errorf("failed to add election official to controller-runtime manager: %w", err))
 		os.Exit(ExitOfficialAdded)
@@ -178,6 +325,9 @@ func main() {
 		for {
 			select {
 			case sig := <-signals:
+				if config.ReleaseOnShutdown {
+					release(logger, candidates, config.SuccessorTimeout)
+				}
 				logger.Infof("exiting due to signal: %s", strings.ToUpper(sig.String()))
 				os.Exit(ExitOK)
 			}
@@ -193,6 +343,213 @@ func main() {
 	logger.Error(fmt.Errorf("manager has stopped"))
 }
 
+// addCandidates adds the candidates for an election, which is one for each leader.
+func addCandidates(mgr ctrl.Manager, logger log.FieldLogger, electionResults chan<- election.Result, electionName types.NamespacedName, config candidate.Config) ([]*candidate.Candidate, error) {
+	leaders := viper.GetInt(Leaders)
+	if leaders > 1 {
+		return candidate.AddSemaphoreToManager(mgr, logger, electionResults, electionName, leaders, config)
+	}
+	c, err := candidate.AddCandidateToManager(mgr, logger, electionResults, electionName, config)
+	if err != nil {
+		return nil, err
+	}
+	return []*candidate.Candidate{c}, nil
+}
+
+func release(logger log.FieldLogger, candidates []*candidate.Candidate, successorTimeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), successorTimeout+10*time.Second)
+	defer cancel()
+
+	err := candidate.ReleaseAll(ctx, candidates)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// restConfig returns the Kubernetes config. The file backend doesn't talk to Kubernetes, but the manager still needs a config.
+func restConfig() (*rest.Config, error) {
+	if viper.GetString(Backend) == BackendFile {
+		return &rest.Config{Host: "http://localhost"}, nil
+	}
+	return ctrl.GetConfig()
+}
+
+// newBackend creates the configured lock backend.
+func newBackend(mgr ctrl.Manager) (backend.Backend, error) {
+	switch kind := viper.GetString(Backend); kind {
+	case BackendLease:
+		return backend.NewLease(mgr.GetClient()), nil
+	case BackendConfigMap:
+		return backend.NewConfigMap(mgr.GetClient()), nil
+	case BackendEtcd:
+		endpoints := splitList(viper.GetStringSlice(EtcdEndpoints))
+		if len(endpoints) == 0 {
+			return nil, fmt.Errorf("--%s is required with the %s backend", EtcdEndpoints, BackendEtcd)
+		}
+		client, err := clientv3.New(clientv3.Config{
+			Endpoints:   endpoints,
+			DialTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create etcd client: %w", err)
+		}
+		return backend.NewEtcd(client, viper.GetString(EtcdPrefix), viper.GetDuration(LeaseDuration)), nil
+	case BackendFile:
+		return backend.NewFile(viper.GetString(LockDir)), nil
+	default:
+		return nil, fmt.Errorf("unsupported backend '%s'", kind)
+	}
+}
+
+// identitySource picks where the candidates get their identity from. An explicit identity goes first,
+// then the downward API, and finally the default of the candidate, which is the hostname.
+func identitySource() candidate.IdentitySource {
+	if identity := viper.GetString(Identity); identity != "" {
+		return candidate.StaticIdentity{Name: identity}
+	}
+	if os.Getenv("POD_NAME") != "" {
+		return candidate.DownwardAPIIdentity{}
+	}
+	return nil
+}
+
+// podNamespace finds the namespace of our own Pod, which can differ from the election namespace.
+func podNamespace(electionNamespace string) string {
+	if namespace := viper.GetString(PodNamespace); namespace != "" {
+		return namespace
+	}
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if namespace, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(namespace)); namespace != "" {
+			return namespace
+		}
+	}
+	return electionNamespace
+}
+
+// electionNames returns the configured elections.
+func electionNames() ([]string, error) {
+	names := splitList(viper.GetStringSlice(ElectionName))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("election '%s' is listed more than once", name)
+		}
+		seen[name] = true
+	}
+	return names, nil
+}
+
+// splitList flattens list options. Values can be given as a list, or separated by commas
+// in a single value, which is what we get from the environment.
+func splitList(values []string) []string {
+	list := make([]string, 0)
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+func candidateConfig() (candidate.Config, error) {
+	config := candidate.Config{
+		Mode:              candidate.Mode(viper.GetString(ElectionMode)),
+		LeaseDuration:     viper.GetDuration(LeaseDuration),
+		RenewInterval:     viper.GetDuration(RenewInterval),
+		ReleaseOnShutdown: viper.GetBool(ReleaseOnShutdown),
+		SuccessorTimeout:  viper.GetDuration(SuccessorTimeout),
+		Priority:          viper.GetInt(Priority),
+		PriorityBackoff:   viper.GetDuration(PriorityBackoff),
+		Preemption:        viper.GetBool(Preemption),
+		CampaignJitter:    viper.GetDuration(CampaignJitter),
+		RetryBackoff:      viper.GetDuration(RetryBackoff),
+		RetryBackoffMax:   viper.GetDuration(RetryBackoffMax),
+		ResyncPeriod:      viper.GetDuration(ResyncPeriod),
+		TopologyBackoff:   viper.GetDuration(TopologyBackoff),
+		Rebalance:         viper.GetBool(Rebalance),
+		MinTenure:         viper.GetDuration(MinTenure),
+		TransitionLimit:   viper.GetInt(TransitionLimit),
+		TransitionWindow:  viper.GetDuration(TransitionWindow),
+		RequireReady:      viper.GetBool(RequireReady),
+		ContainerName:     viper.GetString(ContainerName),
+		PinConfigMap:      viper.GetString(PinConfigMap),
+		Observer:          viper.GetBool(Observer),
+		Local:             viper.GetString(Backend) == BackendFile,
+		IdentitySource:    identitySource(),
+
+		EvictNotReadyAfter:        viper.GetDuration(EvictNotReadyAfter),
+		EvictRestartingAfter:      viper.GetDuration(EvictRestartingAfter),
+		EvictRestartingContainers: splitList(viper.GetStringSlice(EvictRestartingContainers)),
+	}
+
+	if selector := viper.GetString(EligibleSelector); selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return config, fmt.Errorf("invalid --%s: %w", EligibleSelector, err)
+		}
+		config.EligibleSelector = parsed
+	}
+
+	if topology := viper.GetString(PreferredTopology); topology != "" {
+		parsed, err := labels.Parse(topology)
+		if err != nil {
+			return config, fmt.Errorf("invalid --%s: %w", PreferredTopology, err)
+		}
+		config.PreferredTopology = parsed
+	}
+	if config.Rebalance && config.PreferredTopology == nil {
+		return config, fmt.Errorf("--%s requires --%s", Rebalance, PreferredTopology)
+	}
+
+	if config.Local && config.PinConfigMap != "" {
+		return config, fmt.Errorf("--%s is not supported with the %s backend", PinConfigMap, BackendFile)
+	}
+
+	if config.ResyncPeriod < 0 {
+		return config, fmt.Errorf("--%s can't be negative", ResyncPeriod)
+	}
+	if config.MinTenure < 0 {
+		return config, fmt.Errorf("--%s can't be negative", MinTenure)
+	}
+	if config.TransitionLimit < 0 {
+		return config, fmt.Errorf("--%s can't be negative", TransitionLimit)
+	}
+	if config.TransitionLimit > 0 && config.TransitionWindow <= 0 {
+		return config, fmt.Errorf("--%s must be positive when --%s is set", TransitionWindow, TransitionLimit)
+	}
+	if config.CampaignJitter < 0 {
+		return config, fmt.Errorf("--%s can't be negative", CampaignJitter)
+	}
+	if config.RetryBackoff < 0 || config.RetryBackoffMax < config.RetryBackoff {
+		return config, fmt.Errorf("--%s can't be negative, or longer than --%s", RetryBackoff, RetryBackoffMax)
+	}
+
+	if config.Priority < 0 || config.Priority > candidate.MaxPriority {
+		return config, fmt.Errorf("--%s must be between 0 and %d", Priority, candidate.MaxPriority)
+	}
+
+	switch config.Mode {
+	case candidate.ModeOwnerReference:
+	case candidate.ModeRenewing:
+		if config.LeaseDuration < time.Second {
+			return config, fmt.Errorf("--%s must be at least one second", LeaseDuration)
+		}
+		if config.RenewInterval <= 0 || config.RenewInterval >= config.LeaseDuration {
+			return config, fmt.Errorf("--%s must be positive and shorter than --%s", RenewInterval, LeaseDuration)
+		}
+	default:
+		return config, fmt.Errorf("unsupported election mode '%s'", config.Mode)
+	}
+
+	return config, nil
+}
+
 func configureLogging() log.FieldLogger {
 	logger := log.New()
 	logfmt, err := formatter(viper.GetString(LogFormat))
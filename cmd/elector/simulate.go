@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/nais/elector/pkg/election/backend"
+	"github.com/nais/elector/pkg/election/simulation"
+)
+
+// CommandSimulate runs an election between simulated candidates instead of taking part in a real one.
+const CommandSimulate = "simulate"
+
+// Simulation options
+const (
+	SimulateCandidates = "candidates"
+	SimulateDuration   = "duration"
+	SimulateEvent      = "event"
+	SimulatePriorities = "priorities"
+	SimulateZones      = "zones"
+)
+
+const defaultSimulatedElection = "simulation"
+
+// simulating reports whether we were started as "elector simulate".
+func simulating() bool {
+	return len(os.Args) > 1 && os.Args[1] == CommandSimulate
+}
+
+// simulateFlags returns the options only the simulate command takes.
+func simulateFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet(CommandSimulate, flag.ExitOnError)
+	flags.Int(SimulateCandidates, 3, "Number of candidates to start with.")
+	flags.Duration(SimulateDuration, 5*time.Minute, "How long to simulate.")
+	flags.StringArray(SimulateEvent, nil, "Something that happens during the simulation, such as \"30s kill leader\". Can be given several times.")
+	flags.IntSlice(SimulatePriorities, nil, "Priorities of the simulated candidates, given to them round robin.")
+	flags.StringSlice(SimulateZones, nil, fmt.Sprintf("Zones of the simulated candidates, given to them round robin as the %s label on their Nodes.", simulation.LabelZone))
+	return flags
+}
+
+// simulate runs a simulation with the candidate options given on the command line, prints the timeline and returns the exit code.
+func simulate(logger log.FieldLogger) int {
+	config, err := simulationConfig(logger)
+	if err != nil {
+		logger.Error(err)
+		return ExitConfig
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	timeline, err := simulation.Run(ctx, config)
+	if err != nil {
+		logger.Error(fmt.Errorf("simulation failed: %w", err))
+		return ExitRuntime
+	}
+	err = timeline.Print(os.Stdout)
+	if err != nil {
+		logger.Error(err)
+		return ExitRuntime
+	}
+	return ExitOK
+}
+
+func simulationConfig(logger log.FieldLogger) (simulation.Config, error) {
+	candidateConfig, err := candidateConfig()
+	if err != nil {
+		return simulation.Config{}, err
+	}
+	candidates, _ := flag.CommandLine.GetInt(SimulateCandidates)
+	duration, _ := flag.CommandLine.GetDuration(SimulateDuration)
+	priorities, _ := flag.CommandLine.GetIntSlice(SimulatePriorities)
+	zones, _ := flag.CommandLine.GetStringSlice(SimulateZones)
+	config := simulation.Config{
+		Candidates: candidates,
+		Duration:   duration,
+		Priorities: priorities,
+		Zones:      splitList(zones),
+		Candidate:  candidateConfig,
+		Election: types.NamespacedName{
+			Namespace: viper.GetString(ElectionNamespace),
+			Name:      defaultSimulatedElection,
+		},
+		Logger: logger,
+	}
+	if config.Election.Namespace == "" {
+		config.Election.Namespace = "default"
+	}
+	names, err := electionNames()
+	if err != nil {
+		return config, err
+	}
+	switch len(names) {
+	case 0:
+	case 1:
+		config.Election.Name = names[0]
+	default:
+		return config, fmt.Errorf("only one election can be simulated at a time")
+	}
+
+	switch kind := viper.GetString(Backend); kind {
+	case BackendLease:
+		config.NewBackend = func(c client.Client) backend.Backend { return backend.NewLease(c) }
+	case BackendConfigMap:
+		config.NewBackend = func(c client.Client) backend.Backend { return backend.NewConfigMap(c) }
+	default:
+		return config, fmt.Errorf("the %s backend can't be simulated, only %s and %s", kind, BackendLease, BackendConfigMap)
+	}
+	switch {
+	case viper.GetInt(Leaders) != 1:
+		return config, fmt.Errorf("--%s can't be simulated", Leaders)
+	case config.Candidate.Observer:
+		return config, fmt.Errorf("--%s can't be simulated", Observer)
+	case config.Candidate.PinConfigMap != "":
+		return config, fmt.Errorf("--%s can't be simulated", PinConfigMap)
+	case config.Candidates < 1:
+		return config, fmt.Errorf("--%s must be at least 1", SimulateCandidates)
+	case config.Duration <= 0:
+		return config, fmt.Errorf("--%s must be positive", SimulateDuration)
+	}
+	if config.Candidate.PreferredTopology != nil && len(config.Zones) == 0 {
+		return config, fmt.Errorf("--%s needs --%s to place the simulated candidates", PreferredTopology, SimulateZones)
+	}
+
+	events, _ := flag.CommandLine.GetStringArray(SimulateEvent)
+	for _, text := range events {
+		event, err := simulation.ParseEvent(text)
+		if err != nil {
+			return config, err
+		}
+		config.Events = append(config.Events, event)
+	}
+	return config, nil
+}
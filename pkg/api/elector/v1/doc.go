@@ -0,0 +1,4 @@
+// Package electorv1 is the gRPC API of elector, generated from election.proto.
+package electorv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative election.proto
@@ -0,0 +1,291 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: election.proto
+
+package electorv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetLeaderRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The name of the election. Empty means the first election given to elector.
+	Election      string `protobuf:"bytes,1,opt,name=election,proto3" json:"election,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLeaderRequest) Reset() {
+	*x = GetLeaderRequest{}
+	mi := &file_election_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLeaderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLeaderRequest) ProtoMessage() {}
+
+func (x *GetLeaderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_election_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLeaderRequest.ProtoReflect.Descriptor instead.
+func (*GetLeaderRequest) Descriptor() ([]byte, []int) {
+	return file_election_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetLeaderRequest) GetElection() string {
+	if x != nil {
+		return x.Election
+	}
+	return ""
+}
+
+type WatchLeaderRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The name of the election. Empty means the first election given to elector.
+	Election      string `protobuf:"bytes,1,opt,name=election,proto3" json:"election,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchLeaderRequest) Reset() {
+	*x = WatchLeaderRequest{}
+	mi := &file_election_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchLeaderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchLeaderRequest) ProtoMessage() {}
+
+func (x *WatchLeaderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_election_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchLeaderRequest.ProtoReflect.Descriptor instead.
+func (*WatchLeaderRequest) Descriptor() ([]byte, []int) {
+	return file_election_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *WatchLeaderRequest) GetElection() string {
+	if x != nil {
+		return x.Election
+	}
+	return ""
+}
+
+// Result is the same as the JSON result of the HTTP API.
+type Result struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The identity of the leader, or empty if there is none.
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// When the result was last updated, in RFC 3339 format.
+	LastUpdate string `protobuf:"bytes,2,opt,name=last_update,json=lastUpdate,proto3" json:"last_update,omitempty"`
+	// Increases every time leadership changes hands, and can be used as a fencing token.
+	Epoch int64 `protobuf:"varint,3,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	// The slot held by this candidate in an election with several leaders, if any.
+	Slot *int32 `protobuf:"varint,4,opt,name=slot,proto3,oneof" json:"slot,omitempty"`
+	// The leader of each slot in an election with several leaders. Vacant slots are empty.
+	Holders []string `protobuf:"bytes,5,rep,name=holders,proto3" json:"holders,omitempty"`
+	// Set when an operator has pinned leadership to a specific pod.
+	Pinned bool `protobuf:"varint,6,opt,name=pinned,proto3" json:"pinned,omitempty"`
+	// Set when leadership has changed hands too often recently, and the election is frozen.
+	Frozen        bool `protobuf:"varint,7,opt,name=frozen,proto3" json:"frozen,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_election_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_election_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_election_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Result) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Result) GetLastUpdate() string {
+	if x != nil {
+		return x.LastUpdate
+	}
+	return ""
+}
+
+func (x *Result) GetEpoch() int64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *Result) GetSlot() int32 {
+	if x != nil && x.Slot != nil {
+		return *x.Slot
+	}
+	return 0
+}
+
+func (x *Result) GetHolders() []string {
+	if x != nil {
+		return x.Holders
+	}
+	return nil
+}
+
+func (x *Result) GetPinned() bool {
+	if x != nil {
+		return x.Pinned
+	}
+	return false
+}
+
+func (x *Result) GetFrozen() bool {
+	if x != nil {
+		return x.Frozen
+	}
+	return false
+}
+
+var File_election_proto protoreflect.FileDescriptor
+
+const file_election_proto_rawDesc = "" +
+	"\n" +
+	"\x0eelection.proto\x12\n" +
+	"elector.v1\".\n" +
+	"\x10GetLeaderRequest\x12\x1a\n" +
+	"\belection\x18\x01 \x01(\tR\belection\"0\n" +
+	"\x12WatchLeaderRequest\x12\x1a\n" +
+	"\belection\x18\x01 \x01(\tR\belection\"\xbf\x01\n" +
+	"\x06Result\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1f\n" +
+	"\vlast_update\x18\x02 \x01(\tR\n" +
+	"lastUpdate\x12\x14\n" +
+	"\x05epoch\x18\x03 \x01(\x03R\x05epoch\x12\x17\n" +
+	"\x04slot\x18\x04 \x01(\x05H\x00R\x04slot\x88\x01\x01\x12\x18\n" +
+	"\aholders\x18\x05 \x03(\tR\aholders\x12\x16\n" +
+	"\x06pinned\x18\x06 \x01(\bR\x06pinned\x12\x16\n" +
+	"\x06frozen\x18\a \x01(\bR\x06frozenB\a\n" +
+	"\x05_slot2\x95\x01\n" +
+	"\x0fElectionService\x12=\n" +
+	"\tGetLeader\x12\x1c.elector.v1.GetLeaderRequest\x1a\x12.elector.v1.Result\x12C\n" +
+	"\vWatchLeader\x12\x1e.elector.v1.WatchLeaderRequest\x1a\x12.elector.v1.Result0\x01B6Z4github.com/nais/elector/pkg/api/elector/v1;electorv1b\x06proto3"
+
+var (
+	file_election_proto_rawDescOnce sync.Once
+	file_election_proto_rawDescData []byte
+)
+
+func file_election_proto_rawDescGZIP() []byte {
+	file_election_proto_rawDescOnce.Do(func() {
+		file_election_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_election_proto_rawDesc), len(file_election_proto_rawDesc)))
+	})
+	return file_election_proto_rawDescData
+}
+
+var file_election_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_election_proto_goTypes = []any{
+	(*GetLeaderRequest)(nil),   // 0: elector.v1.GetLeaderRequest
+	(*WatchLeaderRequest)(nil), // 1: elector.v1.WatchLeaderRequest
+	(*Result)(nil),             // 2: elector.v1.Result
+}
+var file_election_proto_depIdxs = []int32{
+	0, // 0: elector.v1.ElectionService.GetLeader:input_type -> elector.v1.GetLeaderRequest
+	1, // 1: elector.v1.ElectionService.WatchLeader:input_type -> elector.v1.WatchLeaderRequest
+	2, // 2: elector.v1.ElectionService.GetLeader:output_type -> elector.v1.Result
+	2, // 3: elector.v1.ElectionService.WatchLeader:output_type -> elector.v1.Result
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_election_proto_init() }
+func file_election_proto_init() {
+	if File_election_proto != nil {
+		return
+	}
+	file_election_proto_msgTypes[2].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_election_proto_rawDesc), len(file_election_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_election_proto_goTypes,
+		DependencyIndexes: file_election_proto_depIdxs,
+		MessageInfos:      file_election_proto_msgTypes,
+	}.Build()
+	File_election_proto = out.File
+	file_election_proto_goTypes = nil
+	file_election_proto_depIdxs = nil
+}
@@ -0,0 +1,171 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: election.proto
+
+package electorv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ElectionService_GetLeader_FullMethodName   = "/elector.v1.ElectionService/GetLeader"
+	ElectionService_WatchLeader_FullMethodName = "/elector.v1.ElectionService/WatchLeader"
+)
+
+// ElectionServiceClient is the client API for ElectionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ElectionService reports the outcome of the elections this elector takes part in.
+type ElectionServiceClient interface {
+	// GetLeader returns the current result of an election.
+	GetLeader(ctx context.Context, in *GetLeaderRequest, opts ...grpc.CallOption) (*Result, error)
+	// WatchLeader sends the current result of an election, and then every update to it.
+	WatchLeader(ctx context.Context, in *WatchLeaderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Result], error)
+}
+
+type electionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewElectionServiceClient(cc grpc.ClientConnInterface) ElectionServiceClient {
+	return &electionServiceClient{cc}
+}
+
+func (c *electionServiceClient) GetLeader(ctx context.Context, in *GetLeaderRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, ElectionService_GetLeader_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *electionServiceClient) WatchLeader(ctx context.Context, in *WatchLeaderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Result], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ElectionService_ServiceDesc.Streams[0], ElectionService_WatchLeader_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchLeaderRequest, Result]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ElectionService_WatchLeaderClient = grpc.ServerStreamingClient[Result]
+
+// ElectionServiceServer is the server API for ElectionService service.
+// All implementations must embed UnimplementedElectionServiceServer
+// for forward compatibility.
+//
+// ElectionService reports the outcome of the elections this elector takes part in.
+type ElectionServiceServer interface {
+	// GetLeader returns the current result of an election.
+	GetLeader(context.Context, *GetLeaderRequest) (*Result, error)
+	// WatchLeader sends the current result of an election, and then every update to it.
+	WatchLeader(*WatchLeaderRequest, grpc.ServerStreamingServer[Result]) error
+	mustEmbedUnimplementedElectionServiceServer()
+}
+
+// UnimplementedElectionServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedElectionServiceServer struct{}
+
+func (UnimplementedElectionServiceServer) GetLeader(context.Context, *GetLeaderRequest) (*Result, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetLeader not implemented")
+}
+func (UnimplementedElectionServiceServer) WatchLeader(*WatchLeaderRequest, grpc.ServerStreamingServer[Result]) error {
+	return status.Error(codes.Unimplemented, "method WatchLeader not implemented")
+}
+func (UnimplementedElectionServiceServer) mustEmbedUnimplementedElectionServiceServer() {}
+func (UnimplementedElectionServiceServer) testEmbeddedByValue()                         {}
+
+// UnsafeElectionServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ElectionServiceServer will
+// result in compilation errors.
+type UnsafeElectionServiceServer interface {
+	mustEmbedUnimplementedElectionServiceServer()
+}
+
+func RegisterElectionServiceServer(s grpc.ServiceRegistrar, srv ElectionServiceServer) {
+	// If the following call panics, it indicates UnimplementedElectionServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ElectionService_ServiceDesc, srv)
+}
+
+func _ElectionService_GetLeader_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLeaderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ElectionServiceServer).GetLeader(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ElectionService_GetLeader_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ElectionServiceServer).GetLeader(ctx, req.(*GetLeaderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ElectionService_WatchLeader_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchLeaderRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ElectionServiceServer).WatchLeader(m, &grpc.GenericServerStream[WatchLeaderRequest, Result]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ElectionService_WatchLeaderServer = grpc.ServerStreamingServer[Result]
+
+// ElectionService_ServiceDesc is the grpc.ServiceDesc for ElectionService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ElectionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "elector.v1.ElectionService",
+	HandlerType: (*ElectionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetLeader",
+			Handler:    _ElectionService_GetLeader_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchLeader",
+			Handler:       _ElectionService_WatchLeader_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "election.proto",
+}
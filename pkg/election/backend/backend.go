@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"context"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+)
+
+// AnnotationEpoch records the epoch of the current leadership term on the Lease.
+const AnnotationEpoch = "elector.nais.io/epoch"
+
+// Backend stores the lock for an election. The lock is represented as a Lease whatever it is stored in,
+// so candidates work the same way with every backend.
+//
+// Errors are Kubernetes API errors, so callers can tell a lost race from other failures with
+// k8serrors.IsAlreadyExists, k8serrors.IsConflict and k8serrors.IsNotFound.
+type Backend interface {
+	// Get returns the lock, or nil if nobody holds it.
+	Get(ctx context.Context, name types.NamespacedName) (*coordination_v1.Lease, error)
+	// Acquire creates the lock, failing if it already exists.
+	Acquire(ctx context.Context, lease *coordination_v1.Lease) error
+	// Update writes the lock, failing if it has changed since it was read.
+	Update(ctx context.Context, lease *coordination_v1.Lease) error
+	// Release deletes the lock, failing if it has changed since it was read.
+	Release(ctx context.Context, lease *coordination_v1.Lease) error
+	// Watch makes the controller check the election when the lock changes.
+	Watch(b *builder.Builder) *builder.Builder
+}
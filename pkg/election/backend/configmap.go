@@ -0,0 +1,122 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	core_v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationLock holds the Lease spec, as JSON, on a ConfigMap used as lock.
+const AnnotationLock = "elector.nais.io/lock"
+
+// ConfigMap stores the lock in a ConfigMap named after the election, for clusters where candidates
+// can't use Leases. The Lease spec is kept in the AnnotationLock annotation, and the other annotations,
+// owner references, UID and resourceVersion of the Lease are those of the ConfigMap.
+type ConfigMap struct {
+	client.Client
+}
+
+func NewConfigMap(c client.Client) *ConfigMap {
+	return &ConfigMap{Client: c}
+}
+
+func (m *ConfigMap) Get(ctx context.Context, name types.NamespacedName) (*coordination_v1.Lease, error) {
+	var configMap core_v1.ConfigMap
+	err := m.Client.Get(ctx, name, &configMap)
+	switch {
+	case k8serrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return toLease(&configMap)
+}
+
+func (m *ConfigMap) Acquire(ctx context.Context, lease *coordination_v1.Lease) error {
+	configMap, err := fromLease(lease)
+	if err != nil {
+		return err
+	}
+	if err = m.Create(ctx, configMap); err != nil {
+		return err
+	}
+	lease.ObjectMeta = leaseMeta(configMap)
+	return nil
+}
+
+func (m *ConfigMap) Update(ctx context.Context, lease *coordination_v1.Lease) error {
+	configMap, err := fromLease(lease)
+	if err != nil {
+		return err
+	}
+	if err = m.Client.Update(ctx, configMap); err != nil {
+		return err
+	}
+	lease.ObjectMeta = leaseMeta(configMap)
+	return nil
+}
+
+func (m *ConfigMap) Release(ctx context.Context, lease *coordination_v1.Lease) error {
+	configMap := &core_v1.ConfigMap{
+		ObjectMeta: *lease.ObjectMeta.DeepCopy(),
+	}
+	return m.Delete(ctx, configMap, client.Preconditions{
+		UID:             &lease.UID,
+		ResourceVersion: &lease.ResourceVersion,
+	})
+}
+
+// ReserveEpoch keeps the epoch in a ConfigMap named after the election with EpochSuffix, which has no lock annotation.
+func (m *ConfigMap) ReserveEpoch(ctx context.Context, name types.NamespacedName, floor int64) (int64, error) {
+	epoch := epochName(name)
+	return reserveEpoch(ctx, m.Client, &core_v1.ConfigMap{ObjectMeta: meta_v1.ObjectMeta{Namespace: epoch.Namespace, Name: epoch.Name}}, floor)
+}
+
+func (m *ConfigMap) Watch(b *builder.Builder) *builder.Builder {
+	return b.For(&core_v1.ConfigMap{})
+}
+
+func toLease(configMap *core_v1.ConfigMap) (*coordination_v1.Lease, error) {
+	lease := &coordination_v1.Lease{
+		ObjectMeta: leaseMeta(configMap),
+	}
+	spec, ok := configMap.Annotations[AnnotationLock]
+	if !ok {
+		// Not a lock made by elector, so we can't tell who holds it, or safely replace it
+		return nil, fmt.Errorf("ConfigMap %s/%s has no %s annotation", configMap.Namespace, configMap.Name, AnnotationLock)
+	}
+	if err := json.Unmarshal([]byte(spec), &lease.Spec); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation on ConfigMap %s/%s: %w", AnnotationLock, configMap.Namespace, configMap.Name, err)
+	}
+	return lease, nil
+}
+
+func fromLease(lease *coordination_v1.Lease) (*core_v1.ConfigMap, error) {
+	spec, err := json.Marshal(lease.Spec)
+	if err != nil {
+		return nil, err
+	}
+	configMap := &core_v1.ConfigMap{
+		ObjectMeta: *lease.ObjectMeta.DeepCopy(),
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	configMap.Annotations[AnnotationLock] = string(spec)
+	return configMap, nil
+}
+
+// leaseMeta is the metadata of the ConfigMap, without the lock annotation.
+func leaseMeta(configMap *core_v1.ConfigMap) meta_v1.ObjectMeta {
+	meta := *configMap.ObjectMeta.DeepCopy()
+	delete(meta.Annotations, AnnotationLock)
+	return meta
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordination_v1 "k8s.io/api/coordination/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestConfigMap_RoundTrip(t *testing.T) {
+	now := meta_v1.NewMicroTime(time.Now().Truncate(time.Microsecond))
+	lease := &coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:            "election",
+			Namespace:       "namespace",
+			UID:             "uid",
+			ResourceVersion: "42",
+			Annotations:     map[string]string{"elector.nais.io/epoch": "7"},
+		},
+		Spec: coordination_v1.LeaseSpec{
+			HolderIdentity:       pointer.String("me"),
+			AcquireTime:          &now,
+			RenewTime:            &now,
+			LeaseDurationSeconds: pointer.Int32(15),
+			LeaseTransitions:     pointer.Int32(2),
+		},
+	}
+
+	configMap, err := fromLease(lease)
+	assert.NoError(t, err)
+	assert.Equal(t, lease.UID, configMap.UID)
+	assert.Equal(t, lease.ResourceVersion, configMap.ResourceVersion)
+	assert.Contains(t, configMap.Annotations, AnnotationLock)
+	assert.NotContains(t, lease.Annotations, AnnotationLock)
+
+	roundTrip, err := toLease(configMap)
+	assert.NoError(t, err)
+	assert.Equal(t, lease.ObjectMeta, roundTrip.ObjectMeta)
+	assert.Equal(t, "me", *roundTrip.Spec.HolderIdentity)
+	assert.True(t, now.Equal(roundTrip.Spec.RenewTime))
+	assert.Equal(t, lease.Spec.LeaseTransitions, roundTrip.Spec.LeaseTransitions)
+}
+
+func TestConfigMap_InvalidLock(t *testing.T) {
+	configMap, err := fromLease(&coordination_v1.Lease{})
+	assert.NoError(t, err)
+	configMap.Annotations[AnnotationLock] = "{"
+
+	_, err = toLease(configMap)
+	assert.Error(t, err)
+}
+
+func TestConfigMap_MissingLock(t *testing.T) {
+	configMap, err := fromLease(&coordination_v1.Lease{})
+	assert.NoError(t, err)
+	delete(configMap.Annotations, AnnotationLock)
+
+	lease, err := toLease(configMap)
+	assert.ErrorContains(t, err, AnnotationLock)
+	assert.Nil(t, lease)
+}
@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"context"
+	"strconv"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// EpochSuffix is appended to the name of an election to name the object that keeps its epoch.
+const EpochSuffix = "-epoch"
+
+// Epochs is implemented by backends that keep the epoch of an election apart from its lock. The lock is deleted
+// when leadership is released, so without it a candidate whose clock is behind could start a term with a lower epoch.
+type Epochs interface {
+	// ReserveEpoch returns an epoch for a new leadership term, which is at least floor and higher than
+	// any epoch reserved for the election before. Like writing the lock, it fails with a conflict if
+	// another candidate reserves an epoch at the same time.
+	ReserveEpoch(ctx context.Context, name types.NamespacedName, floor int64) (int64, error)
+}
+
+// epochName is the name of the object that keeps the epoch of the election.
+func epochName(name types.NamespacedName) types.NamespacedName {
+	return types.NamespacedName{Namespace: name.Namespace, Name: name.Name + EpochSuffix}
+}
+
+// reserveEpoch reserves an epoch in the AnnotationEpoch annotation of an object, which is created if it doesn't exist.
+// The object must only have its name and namespace set.
+func reserveEpoch(ctx context.Context, c client.Client, object client.Object, floor int64) (int64, error) {
+	err := c.Get(ctx, client.ObjectKeyFromObject(object), object)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return 0, err
+	}
+
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	last, _ := strconv.ParseInt(annotations[AnnotationEpoch], 10, 64)
+	epoch := max(last+1, floor)
+	annotations[AnnotationEpoch] = strconv.FormatInt(epoch, 10)
+	object.SetAnnotations(annotations)
+
+	if k8serrors.IsNotFound(err) {
+		err = c.Create(ctx, object)
+	} else {
+		err = c.Update(ctx, object)
+	}
+	return epoch, err
+}
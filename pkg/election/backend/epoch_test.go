@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestLease_ReserveEpoch(t *testing.T) {
+	ctx := context.Background()
+	name := types.NamespacedName{Namespace: "namespace", Name: "election"}
+	conflict := false
+	kubernetes := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if conflict {
+				return k8serrors.NewConflict(schema.GroupResource{Resource: "leases"}, obj.GetName(), nil)
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	leases := NewLease(kubernetes)
+
+	epoch, err := leases.ReserveEpoch(ctx, name, 5000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000), epoch)
+
+	epoch, err = leases.ReserveEpoch(ctx, name, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5001), epoch)
+
+	stored := &coordination_v1.Lease{}
+	assert.NoError(t, kubernetes.Get(ctx, epochName(name), stored))
+	assert.Equal(t, "5001", stored.Annotations[AnnotationEpoch])
+
+	// Another candidate reserving at the same time is not retried, since it is campaigning too
+	conflict = true
+	_, err = leases.ReserveEpoch(ctx, name, 1000)
+	assert.True(t, k8serrors.IsConflict(err))
+}
@@ -0,0 +1,309 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Etcd stores the lock as a key in etcd, named <prefix>/<namespace>/<name>. The key is attached to an etcd lease,
+// which the holder keeps alive for as long as it holds the lock. If the holder exits or loses contact with etcd,
+// the key expires after TTL.
+//
+// When the lock is acquired, a new key is created, and its create revision is the epoch. A takeover replaces
+// the value of the key and attaches it to the etcd lease of the new holder, recording one above the mod revision
+// it replaced as the epoch, in the annotationEtcdTerm annotation. That is above every revision of the previous term,
+// and revisions only ever increase, so there is no need to keep the epoch elsewhere.
+// The mod revision is used as resourceVersion, and the create revision as UID.
+type Etcd struct {
+	Client *clientv3.Client
+	Prefix string
+	TTL    time.Duration
+
+	lock sync.Mutex
+	held map[types.NamespacedName]heldKey
+}
+
+// annotationEtcdTerm records the epoch of a leadership term that started by taking over the key.
+const annotationEtcdTerm = "elector.nais.io/etcd-term"
+
+// heldKey is the etcd lease of a key we hold, and how to stop keeping it alive.
+type heldKey struct {
+	lease clientv3.LeaseID
+	stop  context.CancelFunc
+}
+
+func NewEtcd(client *clientv3.Client, prefix string, ttl time.Duration) *Etcd {
+	return &Etcd{
+		Client: client,
+		Prefix: prefix,
+		TTL:    ttl,
+		held:   make(map[types.NamespacedName]heldKey),
+	}
+}
+
+func (e *Etcd) Get(ctx context.Context, name types.NamespacedName) (*coordination_v1.Lease, error) {
+	response, err := e.Client.Get(ctx, e.key(name))
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Kvs) == 0 {
+		e.unhold(ctx, name, 0)
+		return nil, nil
+	}
+	kv := response.Kvs[0]
+	e.unhold(ctx, name, clientv3.LeaseID(kv.Lease))
+	return e.toLease(kv.Value, kv.CreateRevision, kv.ModRevision)
+}
+
+func (e *Etcd) Acquire(ctx context.Context, lease *coordination_v1.Lease) error {
+	name := types.NamespacedName{Namespace: lease.Namespace, Name: lease.Name}
+	key := e.key(name)
+	delete(lease.Annotations, annotationEtcdTerm)
+	value, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	grant, err := e.Client.Grant(ctx, int64(e.TTL.Seconds()))
+	if err != nil {
+		return fmt.Errorf("unable to create etcd lease: %w", err)
+	}
+	response, err := e.Client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(value), clientv3.WithLease(grant.ID))).
+		Commit()
+	if err == nil && !response.Succeeded {
+		err = k8serrors.NewAlreadyExists(leaseResource, name.Name)
+	}
+	if err != nil {
+		_, _ = e.Client.Revoke(context.Background(), grant.ID)
+		return err
+	}
+
+	if err = e.hold(name, grant.ID); err != nil {
+		return err
+	}
+	setRevisions(lease, response.Header.Revision, response.Header.Revision)
+	return nil
+}
+
+// Update writes the Lease. If the holder changes, the new leadership term gets a new epoch.
+func (e *Etcd) Update(ctx context.Context, lease *coordination_v1.Lease) error {
+	name := types.NamespacedName{Namespace: lease.Namespace, Name: lease.Name}
+	current, err := e.Get(ctx, name)
+	switch {
+	case err != nil:
+		return err
+	case current == nil:
+		return k8serrors.NewNotFound(leaseResource, name.Name)
+	case holderIdentity(current) != holderIdentity(lease):
+		return e.takeOver(ctx, name, lease)
+	}
+
+	value, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	key := e.key(name)
+	response, err := e.Client.Txn(ctx).
+		If(e.unchanged(key, lease)...).
+		Then(clientv3.OpPut(key, string(value), clientv3.WithIgnoreLease())).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !response.Succeeded {
+		return e.failure(name, response)
+	}
+	setRevisions(lease, parseRevision(string(lease.UID)), response.Header.Revision)
+	return nil
+}
+
+// takeOver writes the Lease and attaches the key to a new etcd lease of ours, in a single transaction,
+// so nobody else can get the key in between.
+func (e *Etcd) takeOver(ctx context.Context, name types.NamespacedName, lease *coordination_v1.Lease) error {
+	key := e.key(name)
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[annotationEtcdTerm] = strconv.FormatInt(parseRevision(lease.ResourceVersion)+1, 10)
+	value, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	grant, err := e.Client.Grant(ctx, int64(e.TTL.Seconds()))
+	if err != nil {
+		return fmt.Errorf("unable to create etcd lease: %w", err)
+	}
+	response, err := e.Client.Txn(ctx).
+		If(e.unchanged(key, lease)...).
+		Then(clientv3.OpPut(key, string(value), clientv3.WithLease(grant.ID))).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err == nil && !response.Succeeded {
+		err = e.failure(name, response)
+	}
+	if err != nil {
+		_, _ = e.Client.Revoke(context.Background(), grant.ID)
+		return err
+	}
+
+	if err = e.hold(name, grant.ID); err != nil {
+		return err
+	}
+	setRevisions(lease, parseRevision(string(lease.UID)), response.Header.Revision)
+	return nil
+}
+
+func (e *Etcd) Release(ctx context.Context, lease *coordination_v1.Lease) error {
+	name := types.NamespacedName{Namespace: lease.Namespace, Name: lease.Name}
+	key := e.key(name)
+	response, err := e.Client.Txn(ctx).
+		If(e.unchanged(key, lease)...).
+		Then(clientv3.OpDelete(key)).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !response.Succeeded {
+		return e.failure(name, response)
+	}
+	e.unhold(ctx, name, 0)
+	return nil
+}
+
+// Watch watches the keys under the prefix, and checks an election whenever its key changes.
+func (e *Etcd) Watch(b *builder.Builder) *builder.Builder {
+	return b.WatchesRawSource(source.Func(func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		go func() {
+			for ctx.Err() == nil {
+				// The watch channel is closed if the watch fails for good, in which case we start over
+				for response := range e.Client.Watch(clientv3.WithRequireLeader(ctx), e.Prefix+"/", clientv3.WithPrefix()) {
+					for _, event := range response.Events {
+						if name, ok := e.name(string(event.Kv.Key)); ok {
+							queue.Add(reconcile.Request{NamespacedName: name})
+						}
+					}
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+		}()
+		return nil
+	}))
+}
+
+// unchanged compares the key with the UID and resourceVersion of the Lease.
+func (e *Etcd) unchanged(key string, lease *coordination_v1.Lease) []clientv3.Cmp {
+	return []clientv3.Cmp{
+		clientv3.Compare(clientv3.CreateRevision(key), "=", parseRevision(string(lease.UID))),
+		clientv3.Compare(clientv3.ModRevision(key), "=", parseRevision(lease.ResourceVersion)),
+	}
+}
+
+// failure tells why a transaction comparing the key with a Lease failed.
+func (e *Etcd) failure(name types.NamespacedName, response *clientv3.TxnResponse) error {
+	if len(response.Responses) > 0 && len(response.Responses[0].GetResponseRange().Kvs) == 0 {
+		return k8serrors.NewNotFound(leaseResource, name.Name)
+	}
+	return k8serrors.NewConflict(leaseResource, name.Name, fmt.Errorf("the Lease has been modified"))
+}
+
+// hold keeps the etcd lease alive until we release the key, or find that it is gone.
+func (e *Etcd) hold(name types.NamespacedName, lease clientv3.LeaseID) error {
+	ctx, stop := context.WithCancel(context.Background())
+	responses, err := e.Client.KeepAlive(ctx, lease)
+	if err != nil {
+		stop()
+		return fmt.Errorf("unable to keep etcd lease alive: %w", err)
+	}
+	go func() {
+		for range responses {
+		}
+	}()
+
+	e.lock.Lock()
+	previous, ok := e.held[name]
+	e.held[name] = heldKey{lease: lease, stop: stop}
+	e.lock.Unlock()
+	if ok {
+		previous.stop()
+	}
+	return nil
+}
+
+// unhold stops keeping our etcd lease for the key alive, and revokes it, unless it is the given current lease.
+func (e *Etcd) unhold(ctx context.Context, name types.NamespacedName, current clientv3.LeaseID) {
+	e.lock.Lock()
+	held, ok := e.held[name]
+	if !ok || held.lease == current {
+		e.lock.Unlock()
+		return
+	}
+	delete(e.held, name)
+	e.lock.Unlock()
+
+	held.stop()
+	_, _ = e.Client.Revoke(ctx, held.lease)
+}
+
+func (e *Etcd) toLease(value []byte, createRevision, modRevision int64) (*coordination_v1.Lease, error) {
+	lease := &coordination_v1.Lease{}
+	if err := json.Unmarshal(value, lease); err != nil {
+		return nil, fmt.Errorf("invalid Lease in etcd: %w", err)
+	}
+	setRevisions(lease, createRevision, modRevision)
+	return lease, nil
+}
+
+func (e *Etcd) key(name types.NamespacedName) string {
+	return path.Join(e.Prefix, name.Namespace, name.Name)
+}
+
+func (e *Etcd) name(key string) (types.NamespacedName, bool) {
+	parts := strings.Split(strings.TrimPrefix(key, e.Prefix+"/"), "/")
+	if len(parts) != 2 {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true
+}
+
+// setRevisions records the revisions of the key on the Lease. The epoch is the create revision,
+// unless the term started with a takeover, which recorded its own.
+func setRevisions(lease *coordination_v1.Lease, createRevision, modRevision int64) {
+	lease.UID = types.UID(strconv.FormatInt(createRevision, 10))
+	lease.ResourceVersion = strconv.FormatInt(modRevision, 10)
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	epoch := createRevision
+	if term := parseRevision(lease.Annotations[annotationEtcdTerm]); term > 0 {
+		epoch = term
+	}
+	lease.Annotations[AnnotationEpoch] = strconv.FormatInt(epoch, 10)
+}
+
+func parseRevision(revision string) int64 {
+	parsed, _ := strconv.ParseInt(revision, 10, 64)
+	return parsed
+}
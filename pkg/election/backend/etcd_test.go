@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+)
+
+func startEtcd(t *testing.T) *clientv3.Client {
+	t.Helper()
+
+	config := embed.NewConfig()
+	config.Dir = t.TempDir()
+	config.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	config.ListenClientUrls = []url.URL{clientURL}
+	config.AdvertiseClientUrls = []url.URL{clientURL}
+	config.ListenPeerUrls = []url.URL{peerURL}
+	config.AdvertisePeerUrls = []url.URL{peerURL}
+	config.InitialCluster = config.InitialClusterFromName(config.Name)
+
+	server, err := embed.StartEtcd(config)
+	if err != nil {
+		t.Fatalf("unable to start etcd: %v", err)
+	}
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatalf("etcd took too long to start")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unable to connect to etcd: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func freeURL(t *testing.T) url.URL {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", listener.Addr().(*net.TCPAddr).Port)}
+}
+
+func TestEtcd_Election(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	client := startEtcd(t)
+	name := types.NamespacedName{Namespace: "namespace", Name: "election"}
+	lease := func(holder string) *coordination_v1.Lease {
+		return &coordination_v1.Lease{
+			ObjectMeta: meta_v1.ObjectMeta{Namespace: name.Namespace, Name: name.Name},
+			Spec:       coordination_v1.LeaseSpec{HolderIdentity: pointer.String(holder)},
+		}
+	}
+
+	// Each backend keeps its own leases alive, just like separate processes
+	first, second := NewEtcd(client, "/elector", 5*time.Second), NewEtcd(client, "/elector", 5*time.Second)
+
+	current, err := second.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Nil(t, current)
+
+	won := lease("first")
+	assert.NoError(t, first.Acquire(ctx, won))
+	err = second.Acquire(ctx, lease("second"))
+	assert.True(t, k8serrors.IsAlreadyExists(err), "expected AlreadyExists, got %v", err)
+
+	current, err = second.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", *current.Spec.HolderIdentity)
+	assert.Equal(t, won.UID, current.UID)
+	assert.Equal(t, won.ResourceVersion, current.ResourceVersion)
+	epoch := current.Annotations[AnnotationEpoch]
+	assert.Equal(t, string(won.UID), epoch)
+
+	// Renewing keeps the epoch, while a stale write is a conflict
+	assert.NoError(t, first.Update(ctx, won))
+	assert.Equal(t, epoch, won.Annotations[AnnotationEpoch])
+	err = second.Update(ctx, current)
+	assert.True(t, k8serrors.IsConflict(err), "expected Conflict, got %v", err)
+
+	// Taking over starts a new term with a higher epoch, unless somebody else got there first
+	current, err = second.Get(ctx, name)
+	assert.NoError(t, err)
+	stale := current.DeepCopy()
+	current.Spec.HolderIdentity = pointer.String("second")
+	assert.NoError(t, second.Update(ctx, current))
+	assert.Greater(t, parseRevision(current.Annotations[AnnotationEpoch]), parseRevision(epoch))
+	stale.Spec.HolderIdentity = pointer.String("third")
+	err = NewEtcd(client, "/elector", 5*time.Second).Update(ctx, stale)
+	assert.True(t, k8serrors.IsConflict(err), "expected Conflict, got %v", err)
+
+	// The previous holder stops keeping its etcd lease alive when it sees it has lost the key,
+	// which doesn't take the key with it
+	taken, err := first.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", *taken.Spec.HolderIdentity)
+	assert.Empty(t, first.held)
+	taken, err = first.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, current.Annotations[AnnotationEpoch], taken.Annotations[AnnotationEpoch])
+
+	// Renewing after a takeover keeps the epoch of the term
+	assert.NoError(t, second.Update(ctx, current))
+	taken, err = first.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, current.Annotations[AnnotationEpoch], taken.Annotations[AnnotationEpoch])
+
+	err = first.Release(ctx, won)
+	assert.True(t, k8serrors.IsConflict(err), "expected Conflict, got %v", err)
+	assert.NoError(t, second.Release(ctx, current))
+	err = second.Release(ctx, current)
+	assert.True(t, k8serrors.IsNotFound(err), "expected NotFound, got %v", err)
+}
+
+func TestEtcd_Expiry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	client := startEtcd(t)
+	name := types.NamespacedName{Namespace: "namespace", Name: "election"}
+
+	holder := NewEtcd(client, "/elector", 2*time.Second)
+	lease := &coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: name.Namespace, Name: name.Name},
+		Spec:       coordination_v1.LeaseSpec{HolderIdentity: pointer.String("holder")},
+	}
+	assert.NoError(t, holder.Acquire(ctx, lease))
+
+	// The key stays while kept alive, and expires once the holder is gone
+	time.Sleep(3 * time.Second)
+	current, err := holder.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.NotNil(t, current)
+
+	holder.held[name].stop()
+	assert.Eventually(t, func() bool {
+		current, err := NewEtcd(client, "/elector", time.Second).Get(ctx, name)
+		return err == nil && current == nil
+	}, 10*time.Second, 100*time.Millisecond)
+}
@@ -0,0 +1,379 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// filePollInterval is how often the lock directory is checked for changes.
+const filePollInterval = time.Second
+
+// annotationFileLock names the lock file of the current holder on Leases in the file backend.
+const annotationFileLock = "elector.nais.io/file-lock"
+
+var leaseResource = coordination_v1.Resource("leases")
+
+// File stores the lock in a directory shared by candidates on the same machine, so elector can run without Kubernetes.
+// Each election has these files in a subdirectory named after the namespace:
+//
+//   - <name>.json is the Lease, which decides who holds it, like a Lease in Kubernetes.
+//   - <name>.<token>.lock is locked with flock by the holder, with a new token each time the Lease changes hands.
+//     The operating system releases it when the holder exits, so a Lease whose lock is free is treated as gone.
+//     A holder that hangs keeps its lock, but the Lease can still be taken over, for instance once it has expired.
+//   - <name>.guard is locked for the duration of each operation, so reads and writes of the Lease are atomic.
+//   - <name>.epoch is the last epoch reserved, which is kept when the Lease is deleted.
+type File struct {
+	Dir string
+
+	lock  sync.Mutex
+	held  map[types.NamespacedName]heldFile
+	state map[types.NamespacedName]fileState
+}
+
+// heldFile is the lock file we keep locked while holding a Lease.
+type heldFile struct {
+	file  *os.File
+	token string
+}
+
+// fileState is what the poller last saw of an election.
+type fileState struct {
+	modified time.Time
+	held     bool
+}
+
+func NewFile(dir string) *File {
+	return &File{
+		Dir:   dir,
+		held:  make(map[types.NamespacedName]heldFile),
+		state: make(map[types.NamespacedName]fileState),
+	}
+}
+
+func (f *File) Get(ctx context.Context, name types.NamespacedName) (*coordination_v1.Lease, error) {
+	var lease *coordination_v1.Lease
+	err := f.guarded(name, func() error {
+		var err error
+		lease, err = f.read(name)
+		return err
+	})
+	return lease, err
+}
+
+func (f *File) Acquire(ctx context.Context, lease *coordination_v1.Lease) error {
+	name := types.NamespacedName{Namespace: lease.Namespace, Name: lease.Name}
+	return f.guarded(name, func() error {
+		existing, err := f.read(name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return k8serrors.NewAlreadyExists(leaseResource, name.Name)
+		}
+		if err = f.hold(name, lease); err != nil {
+			return err
+		}
+		lease.UID = uuid.NewUUID()
+		lease.ResourceVersion = "1"
+		return f.write(name, lease)
+	})
+}
+
+func (f *File) Update(ctx context.Context, lease *coordination_v1.Lease) error {
+	name := types.NamespacedName{Namespace: lease.Namespace, Name: lease.Name}
+	return f.guarded(name, func() error {
+		existing, err := f.check(name, lease)
+		if err != nil {
+			return err
+		}
+		if holderIdentity(existing) != holderIdentity(lease) {
+			// Taking over the Lease. The previous holder may still have its lock, if it hangs, but its term is over.
+			if err = f.hold(name, lease); err != nil {
+				return err
+			}
+			_ = os.Remove(f.lockPath(name, existing))
+		} else {
+			setFileLock(lease, existing.Annotations[annotationFileLock])
+		}
+		version, _ := strconv.Atoi(existing.ResourceVersion)
+		lease.ResourceVersion = strconv.Itoa(version + 1)
+		return f.write(name, lease)
+	})
+}
+
+func (f *File) Release(ctx context.Context, lease *coordination_v1.Lease) error {
+	name := types.NamespacedName{Namespace: lease.Namespace, Name: lease.Name}
+	return f.guarded(name, func() error {
+		existing, err := f.check(name, lease)
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(f.path(name, ".json")); err != nil {
+			return err
+		}
+		f.unhold(name)
+		_ = os.Remove(f.lockPath(name, existing))
+		return nil
+	})
+}
+
+func (f *File) ReserveEpoch(ctx context.Context, name types.NamespacedName, floor int64) (int64, error) {
+	var epoch int64
+	err := f.guarded(name, func() error {
+		path := f.path(name, ".epoch")
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		last, _ := strconv.ParseInt(string(data), 10, 64)
+		epoch = max(last+1, floor)
+		if err = os.WriteFile(path+".tmp", []byte(strconv.FormatInt(epoch, 10)), 0o644); err != nil {
+			return err
+		}
+		return os.Rename(path+".tmp", path)
+	})
+	return epoch, err
+}
+
+// Watch polls the lock directory, and checks an election when its Lease is written, or its holder lets go of the lock.
+func (f *File) Watch(b *builder.Builder) *builder.Builder {
+	return b.WatchesRawSource(source.Func(func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		go func() {
+			ticker := time.NewTicker(filePollInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					for _, name := range f.poll() {
+						queue.Add(reconcile.Request{NamespacedName: name})
+					}
+				}
+			}
+		}()
+		return nil
+	}))
+}
+
+// poll returns the elections that have changed since the last poll.
+func (f *File) poll() []types.NamespacedName {
+	paths, _ := filepath.Glob(filepath.Join(f.Dir, "*", "*.json"))
+	changed := make([]types.NamespacedName, 0)
+	seen := make(map[types.NamespacedName]bool)
+	for _, path := range paths {
+		name := types.NamespacedName{
+			Namespace: filepath.Base(filepath.Dir(path)),
+			Name:      strings.TrimSuffix(filepath.Base(path), ".json"),
+		}
+		seen[name] = true
+
+		var state fileState
+		_ = f.guarded(name, func() error {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			state.modified = info.ModTime()
+			lease, err := f.read(name)
+			state.held = lease != nil
+			return err
+		})
+
+		f.lock.Lock()
+		if f.state[name] != state {
+			f.state[name] = state
+			changed = append(changed, name)
+		}
+		f.lock.Unlock()
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for name := range f.state {
+		if !seen[name] {
+			delete(f.state, name)
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// guarded runs fn while holding the guard lock of the election.
+func (f *File) guarded(name types.NamespacedName, fn func() error) error {
+	if err := os.MkdirAll(filepath.Join(f.Dir, name.Namespace), 0o755); err != nil {
+		return err
+	}
+	guard, err := os.OpenFile(f.path(name, ".guard"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer guard.Close()
+	if err = syscall.Flock(int(guard.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("unable to lock %s: %w", guard.Name(), err)
+	}
+	defer syscall.Flock(int(guard.Fd()), syscall.LOCK_UN)
+	return fn()
+}
+
+// read returns the Lease, or nil if there is none or its holder has let go of the lock. The caller must hold the guard.
+func (f *File) read(name types.NamespacedName) (*coordination_v1.Lease, error) {
+	data, err := os.ReadFile(f.path(name, ".json"))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		f.unhold(name)
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	lease := &coordination_v1.Lease{}
+	if err = json.Unmarshal(data, lease); err != nil {
+		return nil, fmt.Errorf("invalid Lease in %s: %w", f.path(name, ".json"), err)
+	}
+
+	held, err := f.isHeld(name, lease)
+	if err != nil {
+		return nil, err
+	}
+	if !held {
+		// The holder exited without releasing the Lease
+		f.unhold(name)
+		_ = os.Remove(f.lockPath(name, lease))
+		return nil, os.Remove(f.path(name, ".json"))
+	}
+	return lease, nil
+}
+
+// check returns the current Lease, failing if it is gone or has changed since the given Lease was read.
+// The caller must hold the guard.
+func (f *File) check(name types.NamespacedName, lease *coordination_v1.Lease) (*coordination_v1.Lease, error) {
+	existing, err := f.read(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case existing == nil:
+		return nil, k8serrors.NewNotFound(leaseResource, name.Name)
+	case existing.UID != lease.UID || existing.ResourceVersion != lease.ResourceVersion:
+		return nil, k8serrors.NewConflict(leaseResource, name.Name, fmt.Errorf("the Lease has been modified"))
+	}
+	return existing, nil
+}
+
+func (f *File) write(name types.NamespacedName, lease *coordination_v1.Lease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	path := f.path(name, ".json")
+	if err = os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// isHeld reports whether the holder of the Lease still has its lock, and lets go of a lock we have
+// from an earlier term. The caller must hold the guard.
+func (f *File) isHeld(name types.NamespacedName, lease *coordination_v1.Lease) (bool, error) {
+	token := lease.Annotations[annotationFileLock]
+	f.lock.Lock()
+	held, ours := f.held[name]
+	f.lock.Unlock()
+	if ours && held.token == token {
+		return true, nil
+	}
+	if ours {
+		f.unhold(name)
+	}
+
+	lock, err := os.OpenFile(f.lockPath(name, lease), os.O_RDWR, 0)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	defer lock.Close()
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	switch {
+	case errors.Is(err, syscall.EWOULDBLOCK):
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	return false, syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+}
+
+// hold takes a new lock file for the Lease, and records it on the Lease. The caller must hold the guard.
+func (f *File) hold(name types.NamespacedName, lease *coordination_v1.Lease) error {
+	f.unhold(name)
+
+	token := string(uuid.NewUUID())
+	setFileLock(lease, token)
+	lock, err := os.OpenFile(f.lockPath(name, lease), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		return fmt.Errorf("unable to lock %s: %w", lock.Name(), err)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.held[name] = heldFile{file: lock, token: token}
+	return nil
+}
+
+// unhold lets go of our lock file, if we have one. The caller must hold the guard.
+func (f *File) unhold(name types.NamespacedName) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if held, ok := f.held[name]; ok {
+		// Closing the file releases the lock
+		_ = os.Remove(held.file.Name())
+		held.file.Close()
+		delete(f.held, name)
+	}
+}
+
+// lockPath is the lock file of the holder of the Lease.
+func (f *File) lockPath(name types.NamespacedName, lease *coordination_v1.Lease) string {
+	return f.path(name, "."+lease.Annotations[annotationFileLock]+".lock")
+}
+
+func setFileLock(lease *coordination_v1.Lease, token string) {
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[annotationFileLock] = token
+}
+
+func (f *File) path(name types.NamespacedName, suffix string) string {
+	return filepath.Join(f.Dir, name.Namespace, name.Name+suffix)
+}
+
+func holderIdentity(lease *coordination_v1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+)
+
+func TestFile_Election(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	name := types.NamespacedName{Namespace: "local", Name: "election"}
+	lease := func(holder string) *coordination_v1.Lease {
+		return &coordination_v1.Lease{
+			ObjectMeta: meta_v1.ObjectMeta{Namespace: name.Namespace, Name: name.Name},
+			Spec:       coordination_v1.LeaseSpec{HolderIdentity: pointer.String(holder)},
+		}
+	}
+
+	// Each backend takes its own locks, just like separate processes
+	first, second := NewFile(dir), NewFile(dir)
+
+	current, err := second.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Nil(t, current)
+
+	won := lease("first")
+	assert.NoError(t, first.Acquire(ctx, won))
+	err = second.Acquire(ctx, lease("second"))
+	assert.True(t, k8serrors.IsAlreadyExists(err), "expected AlreadyExists, got %v", err)
+
+	current, err = second.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", *current.Spec.HolderIdentity)
+	assert.Equal(t, []types.NamespacedName{name}, second.poll())
+	assert.Empty(t, second.poll())
+
+	// Writing from a stale read is a conflict
+	assert.NoError(t, first.Update(ctx, won))
+	err = second.Release(ctx, lease("first"))
+	assert.True(t, k8serrors.IsConflict(err), "expected Conflict, got %v", err)
+
+	// A holder that lets go of the lock without releasing the Lease, like when exiting, loses it
+	first.unhold(name)
+	current, err = second.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Nil(t, current)
+
+	won = lease("second")
+	assert.NoError(t, second.Acquire(ctx, won))
+	assert.NoError(t, second.Release(ctx, won))
+	current, err = first.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Nil(t, current)
+}
+
+func TestFile_ReserveEpoch(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	name := types.NamespacedName{Namespace: "local", Name: "election"}
+
+	epoch, err := NewFile(dir).ReserveEpoch(ctx, name, 5000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000), epoch)
+
+	// Another process with a clock that is behind continues from the last epoch reserved
+	epoch, err = NewFile(dir).ReserveEpoch(ctx, name, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5001), epoch)
+}
+
+func TestFile_TakeOverFromHungHolder(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	name := types.NamespacedName{Namespace: "local", Name: "election"}
+	first, second := NewFile(dir), NewFile(dir)
+
+	won := &coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: name.Namespace, Name: name.Name},
+		Spec:       coordination_v1.LeaseSpec{HolderIdentity: pointer.String("first")},
+	}
+	assert.NoError(t, first.Acquire(ctx, won))
+
+	// The first holder keeps its lock, but stops renewing, so the Lease is taken over
+	current, err := second.Get(ctx, name)
+	assert.NoError(t, err)
+	current.Spec.HolderIdentity = pointer.String("second")
+	assert.NoError(t, second.Update(ctx, current))
+
+	current, err = first.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", *current.Spec.HolderIdentity)
+
+	// The old holder can no longer write, and the new one keeps the Lease when the old one exits
+	err = first.Update(ctx, won)
+	assert.True(t, k8serrors.IsConflict(err), "expected Conflict, got %v", err)
+	first.unhold(name)
+	current, err = first.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", *current.Spec.HolderIdentity)
+
+	// Renewing keeps the lock of the current term
+	assert.NoError(t, second.Update(ctx, current))
+	current, err = first.Get(ctx, name)
+	assert.NoError(t, err)
+	assert.NotNil(t, current)
+}
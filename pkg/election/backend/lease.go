@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"context"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Lease stores the lock in a coordination.k8s.io Lease named after the election.
+type Lease struct {
+	client.Client
+}
+
+func NewLease(c client.Client) *Lease {
+	return &Lease{Client: c}
+}
+
+func (l *Lease) Get(ctx context.Context, name types.NamespacedName) (*coordination_v1.Lease, error) {
+	var lease coordination_v1.Lease
+	err := l.Client.Get(ctx, name, &lease)
+	switch {
+	case k8serrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	default:
+		return &lease, nil
+	}
+}
+
+func (l *Lease) Acquire(ctx context.Context, lease *coordination_v1.Lease) error {
+	return l.Create(ctx, lease)
+}
+
+func (l *Lease) Update(ctx context.Context, lease *coordination_v1.Lease) error {
+	return l.Client.Update(ctx, lease)
+}
+
+func (l *Lease) Release(ctx context.Context, lease *coordination_v1.Lease) error {
+	return l.Delete(ctx, lease, client.Preconditions{
+		UID:             &lease.UID,
+		ResourceVersion: &lease.ResourceVersion,
+	})
+}
+
+func (l *Lease) Watch(b *builder.Builder) *builder.Builder {
+	return b.For(&coordination_v1.Lease{})
+}
+
+// ReserveEpoch keeps the epoch in a Lease named after the election with EpochSuffix, which nobody holds.
+func (l *Lease) ReserveEpoch(ctx context.Context, name types.NamespacedName, floor int64) (int64, error) {
+	epoch := epochName(name)
+	return reserveEpoch(ctx, l.Client, &coordination_v1.Lease{ObjectMeta: meta_v1.ObjectMeta{Namespace: epoch.Namespace, Name: epoch.Name}}, floor)
+}
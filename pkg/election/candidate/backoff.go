@@ -0,0 +1,36 @@
+package candidate
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// jitter returns a random delay of up to CampaignJitter, which spreads out campaigns from candidates
+// that all see the Lease disappear or expire at the same time.
+func (c *Candidate) jitter() time.Duration {
+	if c.CampaignJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(c.CampaignJitter)))
+}
+
+// retryLimiter decides when to check the election again after a failed check. Controller-runtime ignores
+// the result of a failed reconcile, and retries with exponential backoff from this limiter instead.
+func (c *Candidate) retryLimiter() workqueue.TypedRateLimiter[reconcile.Request] {
+	return &jitteredBackoff{
+		TypedRateLimiter: workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](c.RetryBackoff, c.RetryBackoffMax),
+	}
+}
+
+// jitteredBackoff adds up to half of the delay at random, so candidates that fail together don't retry together.
+type jitteredBackoff struct {
+	workqueue.TypedRateLimiter[reconcile.Request]
+}
+
+func (b *jitteredBackoff) When(request reconcile.Request) time.Duration {
+	delay := b.TypedRateLimiter.When(request)
+	return delay + time.Duration(rand.Int64N(int64(delay)/2+1))
+}
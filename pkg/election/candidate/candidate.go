@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
+	"regexp"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -13,67 +15,211 @@ import (
 	core_v1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/nais/elector/pkg/election"
+	"github.com/nais/elector/pkg/election/backend"
 	"github.com/nais/elector/pkg/logging"
 	"github.com/nais/elector/pkg/metrics"
 )
 
+// Mode selects how a Candidate keeps hold of a Lease once it has won it.
+type Mode string
+
+const (
+	// ModeOwnerReference keeps leadership for as long as the leader Pod exists.
+	ModeOwnerReference Mode = "owner-reference"
+	// ModeRenewing requires the leader to renew the Lease periodically, and lets followers take over an expired Lease.
+	ModeRenewing Mode = "renewing"
+)
+
+// Config holds the settings that control how a Candidate campaigns.
+type Config struct {
+	// Backend stores the lock. Default is a Lease.
+	Backend           backend.Backend
+	Mode              Mode
+	LeaseDuration     time.Duration
+	RenewInterval     time.Duration
+	ReleaseOnShutdown bool
+	SuccessorTimeout  time.Duration
+	Priority          int
+	PriorityBackoff   time.Duration
+	Preemption        bool
+	RequireReady      bool
+	EligibleSelector  labels.Selector
+	// ContainerName is the name of the elector container, which is left out when checking readiness.
+	ContainerName string
+	// PodNamespace is the namespace of our own Pod, if different from the election namespace.
+	PodNamespace string
+	// IdentitySource tells the candidate who it is. Default is the hostname, or the hostname and process ID for Local candidates.
+	IdentitySource IdentitySource
+	// Local candidates run outside Kubernetes, without a Pod.
+	Local bool
+	// Observer candidates only report the leader, and never campaign.
+	Observer bool
+	// PinConfigMap is the name of a ConfigMap that can pin leadership to a Pod, in addition to the Lease.
+	PinConfigMap string
+
+	// PreferredTopology selects the Nodes leaders should run on, by labels such as topology.kubernetes.io/zone.
+	// Candidates on other Nodes wait TopologyBackoff before campaigning, and with Rebalance,
+	// a ready candidate in the preferred topology asks a leader outside it to step down.
+	PreferredTopology labels.Selector
+	TopologyBackoff   time.Duration
+	Rebalance         bool
+
+	// MinTenure is the shortest time a leader holds leadership before stepping down voluntarily or being evicted.
+	MinTenure time.Duration
+	// More than TransitionLimit changes of leadership within TransitionWindow freezes the election,
+	// until enough of them are outside the window. Zero disables.
+	TransitionLimit  int
+	TransitionWindow time.Duration
+
+	// CampaignJitter is the most to wait, at random, before campaigning or taking over an expired Lease.
+	CampaignJitter time.Duration
+	// RetryBackoff is the first delay before checking the election again after an error. It doubles
+	// for each consecutive error, up to RetryBackoffMax. Zero keeps the controller-runtime default.
+	RetryBackoff    time.Duration
+	RetryBackoffMax time.Duration
+	// ResyncPeriod is how often the election is checked, in addition to when watched resources change,
+	// so that missed events can't leave the results stale. Zero disables.
+	ResyncPeriod time.Duration
+
+	// Evict leaders that have been NotReady, or had containers restarting, for longer than this. Zero disables.
+	EvictNotReadyAfter        time.Duration
+	EvictRestartingAfter      time.Duration
+	EvictRestartingContainers []string
+}
+
+var invalidControllerNameChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
 type Candidate struct {
 	client.Client
+	Config
 	Clock           clock.Clock
 	Logger          logrus.FieldLogger
-	ElectionResults chan<- string
+	ElectionResults chan<- election.Result
 	ElectionName    types.NamespacedName
+	// APIReader is used to read Pods in namespaces outside the cache.
+	APIReader client.Reader
 
 	ownerReference *meta_v1.OwnerReference
-	hostname       string
+	setUp          atomic.Bool
+	identity       string
 	setupLock      sync.Mutex
 	campaignLock   sync.Mutex
+	resigned       atomic.Bool
+	holdoffUntil   time.Time
+	campaignAt     time.Time
+	self           atomic.Value // types.NamespacedName of our Pod, stored once setup has found it
+	leader         atomic.Value // types.NamespacedName of the leader Pod
+	lastEpoch      atomic.Int64
+	pinned         atomic.Bool
+	preferred      bool
+	slot           int
+	slots          *slotGroup
+	health         healthTracker
+	breaker        transitionBreaker
+
+	// renewedAt is when we last renewed a Lease we hold in renewing mode, in Unix nanoseconds, or zero if we hold none
+	renewedAt atomic.Int64
+	// wake has the controller check the election, when something other than a watched resource calls for it
+	wake chan event.GenericEvent
 }
 
-func AddCandidateToManager(mgr ctrl.Manager, logger logrus.FieldLogger, electionResults chan<- string, electionName types.NamespacedName) error {
-	candidate := Candidate{
+func AddCandidateToManager(mgr ctrl.Manager, logger logrus.FieldLogger, electionResults chan<- election.Result, electionName types.NamespacedName, config Config) (*Candidate, error) {
+	if config.Backend == nil {
+		config.Backend = backend.NewLease(mgr.GetClient())
+	}
+	candidate := &Candidate{
 		Client:          mgr.GetClient(),
+		Config:          config,
 		Clock:           &clock.RealClock{},
 		Logger:          logger.WithField(logging.FieldComponent, "Candidate"),
 		ElectionResults: electionResults,
 		ElectionName:    electionName,
+		APIReader:       mgr.GetAPIReader(),
+		wake:            make(chan event.GenericEvent, 1),
 	}
 
-	err := mgr.AddReadyzCheck("candidate", candidate.readyz)
+	err := mgr.AddReadyzCheck("candidate-"+electionName.Name, candidate.readyz)
 	if err != nil {
-		return fmt.Errorf("failed to add candidate readiness check to controller-runtime manager: %w", err)
+		return nil, fmt.Errorf("failed to add candidate readiness check to controller-runtime manager: %w", err)
 	}
 
-	err = mgr.Add(&candidate)
+	err = mgr.Add(candidate)
 	if err != nil {
-		return fmt.Errorf("failed to add candidate runnable to controller-runtime manager: %w", err)
+		return nil, fmt.Errorf("failed to add candidate runnable to controller-runtime manager: %w", err)
 	}
 
-	err = ctrl.NewControllerManagedBy(mgr).
-		For(&coordination_v1.Lease{}).
-		Complete(&candidate)
+	builder := config.Backend.Watch(ctrl.NewControllerManagedBy(mgr).
+		Named(controllerName(electionName))).
+		WatchesRawSource(source.Channel(candidate.wake, &handler.EnqueueRequestForObject{}))
+	if !config.Observer && !config.Local {
+		builder = builder.Watches(&core_v1.Pod{}, handler.EnqueueRequestsFromMapFunc(candidate.mapPod))
+	}
+	if config.PinConfigMap != "" {
+		builder = builder.Watches(&core_v1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(candidate.mapConfigMap))
+	}
+	if config.RetryBackoff > 0 {
+		builder = builder.WithOptions(controller.Options{RateLimiter: candidate.retryLimiter()})
+	}
+	err = builder.Complete(candidate)
 	if err != nil {
-		return fmt.Errorf("failed to add candidate controller to controller-runtime manager: %w", err)
+		return nil, fmt.Errorf("failed to add candidate controller to controller-runtime manager: %w", err)
 	}
 
-	return nil
+	return candidate, nil
+}
+
+// controllerName gives each candidate a unique controller name, made up of characters valid in metric labels.
+func controllerName(electionName types.NamespacedName) string {
+	return "candidate_" + invalidControllerNameChars.ReplaceAllString(electionName.Name, "_")
+}
+
+// mapPod turns events for our own Pod, or the leader Pod, into a check of the election.
+func (c *Candidate) mapPod(_ context.Context, pod client.Object) []reconcile.Request {
+	// Pods are mapped while setup may still be running, so we can't read our identity directly
+	self, _ := c.self.Load().(types.NamespacedName)
+	leader, _ := c.leader.Load().(types.NamespacedName)
+	name := types.NamespacedName{Namespace: pod.GetNamespace(), Name: pod.GetName()}
+	if name != self && name != leader {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: c.ElectionName}}
+}
+
+// recheck has the election checked again soon, unless a check is already pending.
+func (c *Candidate) recheck() {
+	lease := &coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      c.ElectionName.Name,
+			Namespace: c.ElectionName.Namespace,
+		},
+	}
+	select {
+	case c.wake <- event.GenericEvent{Object: lease}:
+	default:
+	}
 }
 
 func (c *Candidate) readyz(_ *http.Request) error {
-	if c.ownerReference == nil {
+	if !c.setUp.Load() {
 		return fmt.Errorf("candidate has not performed setup")
 	}
 	return nil
 }
 
 func (c *Candidate) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
-	if c.ownerReference == nil {
+	if !c.setUp.Load() {
 		err := c.setup(ctx)
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to initialize candidate: %w", err)
@@ -88,61 +234,216 @@ func (c *Candidate) Reconcile(ctx context.Context, request reconcile.Request) (r
 	return c.checkLease(ctx)
 }
 
+// Start has the election checked once, and then every ResyncPeriod. The checks go through the controller queue
+// like those for watched resources, so that only one check runs at a time, and failed checks are retried with backoff.
 func (c *Candidate) Start(ctx context.Context) error {
-	ticker := c.Clock.NewTimer(time.Minute * 1)
-
-	if c.ownerReference == nil {
+	if !c.setUp.Load() {
 		err := c.setup(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to initialize candidate: %w", err)
 		}
 	}
 
+	c.recheck()
+	if c.ResyncPeriod <= 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	timer := c.Clock.NewTimer(c.ResyncPeriod)
+	defer timer.Stop()
 	for {
-		_, err := c.checkLease(ctx)
-		if err != nil {
-			return err
-		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ticker.C():
-			continue
+		case <-timer.C():
+			c.Logger.Debugf("Resyncing %v", c.ElectionName)
+			c.recheck()
+			timer.Reset(c.ResyncPeriod)
 		}
 	}
 }
 
 func (c *Candidate) checkLease(ctx context.Context) (ctrl.Result, error) {
+	result, err := c.checkElection(ctx)
+	if err != nil {
+		return c.checkRenewDeadline(err)
+	}
+	return result, nil
+}
+
+func (c *Candidate) checkElection(ctx context.Context) (ctrl.Result, error) {
 	var err error
 	var lease *coordination_v1.Lease
 
+	if c.Observer {
+		return c.observe(ctx)
+	}
+
+	if c.ReleaseOnShutdown && !c.Local && !c.resigned.Load() {
+		terminating, err := c.podTerminating(ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if terminating {
+			c.Logger.Infof("Pod %v is terminating", c.identity)
+			if _, err = c.resign(ctx); err != nil {
+				c.Logger.Error(err)
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
 	c.Logger.Debugf("Checking Lease %v", c.ElectionName)
 	if lease, err = c.getLease(ctx); err != nil {
-		return ctrl.Result{Requeue: true, RequeueAfter: 5 * time.Second}, err
+		return ctrl.Result{}, err
+	}
+	if c.resigned.Load() {
+		c.updateElection(lease)
+		return ctrl.Result{}, nil
+	}
+	pinned, err := c.pinnedHolder(ctx, lease)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	c.pinned.Store(pinned != "")
+	if pinned != "" {
+		return c.followPin(ctx, lease, pinned)
+	}
+	if until, frozen := c.frozen(); frozen && !c.leaderGone(lease) {
+		return c.whileFrozen(ctx, lease, until)
+	}
+	result := ctrl.Result{}
+	holding := lease != nil && c.isHolder(lease)
+	reason, err := c.ineligible(ctx, holding)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if reason != "" {
+		c.Logger.Debugf("Not eligible for %v: Pod %s", c.ElectionName, reason)
+		if holding {
+			tenure := c.tenureRemaining(lease)
+			if tenure > 0 {
+				c.Logger.Infof("Not stepping down as leader of %v for another %v, to serve the minimum tenure", c.ElectionName, tenure)
+				result = ctrl.Result{RequeueAfter: tenure}
+			}
+		}
+		if result.RequeueAfter == 0 {
+			if holding {
+				if err = c.stepDown(ctx, "Pod "+reason); err != nil {
+					c.Logger.Error(err)
+					return ctrl.Result{}, err
+				}
+				lease = nil
+			}
+			c.updateElection(lease)
+			return ctrl.Result{}, nil
+		}
+	}
+	if lease != nil {
+		var preemption ctrl.Result
+		if lease, preemption, err = c.checkPreemption(ctx, lease); err != nil {
+			err = fmt.Errorf("error during preemption: %w", err)
+			c.Logger.Error(err)
+			return ctrl.Result{}, err
+		}
+		result = earliest(result, preemption)
+	}
+	if lease != nil && !c.isHolder(lease) {
+		var orphan ctrl.Result
+		if lease, orphan, err = c.checkOrphaned(ctx, lease); err != nil {
+			err = fmt.Errorf("error checking for orphaned lease: %w", err)
+			c.Logger.Error(err)
+			return ctrl.Result{}, err
+		}
+		result = earliest(result, orphan)
+	}
+	if lease != nil && !c.isHolder(lease) && c.evictionEnabled() {
+		var health ctrl.Result
+		if lease, health, err = c.checkLeaderHealth(ctx, lease); err != nil {
+			err = fmt.Errorf("error checking leader health: %w", err)
+			c.Logger.Error(err)
+			return ctrl.Result{}, err
+		}
+		result = earliest(result, health)
 	}
 	if lease == nil {
+		if wait := c.campaignWait(); wait > 0 {
+			// Make sure we don't keep reporting a leader that is gone while we wait
+			c.updateElection(nil)
+			c.Logger.Debugf("Waiting %v before campaigning for %v", wait, c.ElectionName)
+			return earliest(result, ctrl.Result{RequeueAfter: wait}), nil
+		}
 		c.Logger.Infof("No existing Lease, running campaign for %v", c.ElectionName)
 		lease, err = c.runCampaign(ctx)
 		if err != nil {
 			err = fmt.Errorf("error during campaign: %w", err)
 			c.Logger.Error(err)
-			return ctrl.Result{Requeue: true, RequeueAfter: 5 * time.Second}, err
+			return ctrl.Result{}, err
+		}
+	}
+	if c.Mode == ModeRenewing && lease != nil {
+		var renewal ctrl.Result
+		lease, renewal, err = c.maintainLease(ctx, lease)
+		if err != nil {
+			err = fmt.Errorf("error maintaining lease: %w", err)
+			c.Logger.Error(err)
+			return ctrl.Result{}, err
 		}
+		result = earliest(result, renewal)
 	}
+	c.logSuccession(lease)
+	c.updateElection(lease)
+	return result, nil
+}
+
+// observe reports the current leader, without ever taking part in the election.
+func (c *Candidate) observe(ctx context.Context) (ctrl.Result, error) {
+	lease, err := c.getLease(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	pinned, err := c.pinnedHolder(ctx, lease)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	c.pinned.Store(pinned != "")
 	c.updateElection(lease)
 	return ctrl.Result{}, nil
 }
 
 func (c *Candidate) getLease(ctx context.Context) (*coordination_v1.Lease, error) {
-	var lease coordination_v1.Lease
-	err := c.Get(ctx, c.ElectionName, &lease)
+	return c.Backend.Get(ctx, c.ElectionName)
+}
+
+func (c *Candidate) getOwnPod(ctx context.Context) (*core_v1.Pod, error) {
+	return c.getPod(ctx, c.podNamespace(), c.identity)
+}
+
+// getPod reads Pods in our own namespace and the election namespace from the cache, and others directly from the API server.
+func (c *Candidate) getPod(ctx context.Context, namespace, name string) (*core_v1.Pod, error) {
+	if c.Local {
+		return nil, nil
+	}
+
+	var reader client.Reader = c.Client
+	if c.APIReader != nil && namespace != c.podNamespace() && namespace != c.ElectionName.Namespace {
+		reader = c.APIReader
+	}
+
+	pod := &core_v1.Pod{}
+	key := client.ObjectKey{
+		Namespace: namespace,
+		Name:      name,
+	}
+	err := reader.Get(ctx, key, pod)
 	switch {
 	case k8serrors.IsNotFound(err):
 		return nil, nil
 	case err != nil:
 		return nil, err
 	default:
-		return &lease, nil
+		return pod, nil
 	}
 }
 
@@ -150,25 +451,32 @@ func (c *Candidate) runCampaign(ctx context.Context) (*coordination_v1.Lease, er
 	c.campaignLock.Lock()
 	defer c.campaignLock.Unlock()
 
+	if c.resigned.Load() {
+		return c.getLease(ctx)
+	}
+	if c.slots != nil {
+		c.slots.lock.Lock()
+		defer c.slots.lock.Unlock()
+		if c.slots.holdsOther(c.slot) {
+			return c.getLease(ctx)
+		}
+	}
+
 	lease := &coordination_v1.Lease{
 		ObjectMeta: meta_v1.ObjectMeta{
 			Name:      c.ElectionName.Name,
 			Namespace: c.ElectionName.Namespace,
-			OwnerReferences: []meta_v1.OwnerReference{
-				*c.ownerReference,
-			},
-		},
-		Spec: coordination_v1.LeaseSpec{
-			HolderIdentity: &c.hostname,
-			AcquireTime: &meta_v1.MicroTime{
-				Time: time.Now(),
-			},
 		},
 	}
 
-	err := c.Create(ctx, lease)
+	metrics.CampaignAttempts.WithLabelValues(metrics.CampaignCreate).Inc()
+	err := c.claimLease(ctx, lease)
+	if err == nil {
+		err = c.Backend.Acquire(ctx, lease)
+	}
 	if err != nil {
 		if k8serrors.IsAlreadyExists(err) || k8serrors.IsConflict(err) {
+			metrics.CampaignConflicts.WithLabelValues(metrics.CampaignCreate).Inc()
 			metrics.ElectionsLost.WithLabelValues().Inc()
 			c.Logger.Infof("Lost election %v", c.ElectionName)
 			return c.getLease(ctx)
@@ -178,44 +486,148 @@ func (c *Candidate) runCampaign(ctx context.Context) (*coordination_v1.Lease, er
 	}
 	metrics.ElectionsWon.WithLabelValues().Inc()
 	c.Logger.Infof("Won election %v", c.ElectionName)
+	if c.slots != nil {
+		c.slots.held[c.slot] = true
+	}
 	return lease, nil
 }
 
+// claimLease makes the candidate the holder of the given Lease, with the epoch of a new leadership term.
+// Reserving the epoch fails with a conflict if another candidate is campaigning at the same time.
+func (c *Candidate) claimLease(ctx context.Context, lease *coordination_v1.Lease) error {
+	epoch, err := c.reserveEpoch(ctx, lease)
+	if err != nil {
+		return err
+	}
+	now := meta_v1.NewMicroTime(c.Clock.Now())
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	c.setOwnership(lease)
+	lease.Spec.HolderIdentity = &c.identity
+	lease.Spec.AcquireTime = &now
+	lease.Annotations[AnnotationPriority] = strconv.Itoa(c.Priority)
+	lease.Annotations[AnnotationEpoch] = strconv.FormatInt(epoch, 10)
+	delete(lease.Annotations, AnnotationPreemptedBy)
+	c.setPreferred(lease)
+	if c.Mode == ModeRenewing {
+		lease.Spec.RenewTime = &now
+		lease.Spec.LeaseDurationSeconds = c.leaseDurationSeconds()
+	}
+	return nil
+}
+
 func (c *Candidate) updateElection(lease *coordination_v1.Lease) {
+	if c.slots != nil {
+		c.slots.setHeld(c.slot, lease != nil && c.isHolder(lease))
+	}
+	c.observeRenewal(lease)
 	if lease != nil {
-		c.Logger.Debugf("Sending election results, leader is: %v", *lease.Spec.HolderIdentity)
-		c.ElectionResults <- *lease.Spec.HolderIdentity
+		c.endCampaignWait()
+	}
+	if lease == nil {
+		c.Logger.Debugf("Sending election results, there is no leader")
+		c.ElectionResults <- election.Result{Identity: c.identity, Frozen: c.isFrozen()}
+		return
+	}
+	result := election.Result{
+		Leader:   holder(lease),
+		Identity: c.identity,
+		Epoch:    c.observeEpoch(lease),
+		Pinned:   c.pinned.Load(),
+	}
+	c.observeTransition(result.Epoch)
+	result.Frozen = c.isFrozen()
+	c.leader.Store(types.NamespacedName{Namespace: holderNamespace(lease, c.ElectionName.Namespace), Name: result.Leader})
+	c.Logger.Debugf("Sending election results, leader is: %v, epoch: %d", result.Leader, result.Epoch)
+	c.ElectionResults <- result
+}
+
+// earliest combines two results, so that we are called again at the earliest time either asks for.
+func earliest(a, b ctrl.Result) ctrl.Result {
+	switch {
+	case a.IsZero():
+		return b
+	case b.IsZero():
+		return a
+	case a.Requeue && a.RequeueAfter == 0:
+		return a
+	case b.Requeue && b.RequeueAfter == 0:
+		return b
+	case a.RequeueAfter == 0:
+		return b
+	case b.RequeueAfter == 0 || a.RequeueAfter < b.RequeueAfter:
+		return a
 	}
+	return b
 }
 
 func (c *Candidate) setup(ctx context.Context) error {
 	c.setupLock.Lock()
 	defer c.setupLock.Unlock()
 
+	if c.setUp.Load() {
+		return nil
+	}
+
 	c.Logger.Info("Starting candidate setup")
-	hostname, err := os.Hostname()
+	if c.Observer {
+		c.setUp.Store(true)
+		c.Logger.Info("Candidate setup complete, observing only")
+		return nil
+	}
+
+	identity, err := c.identitySource().Identity()
 	if err != nil {
-		return fmt.Errorf("unable to get hostname: %w", err)
+		return fmt.Errorf("unable to get identity: %w", err)
+	}
+
+	if c.Local {
+		c.identity = identity.Name
+		c.setUp.Store(true)
+		c.Logger.Infof("Candidate setup complete, running locally as %s", c.identity)
+		return nil
 	}
 
 	pod := &core_v1.Pod{}
 
 	key := client.ObjectKey{
-		Namespace: c.ElectionName.Namespace,
-		Name:      hostname,
+		Namespace: c.podNamespace(),
+		Name:      identity.Name,
 	}
 	err = c.Get(ctx, key, pod)
 	if err != nil {
 		return fmt.Errorf("unable to get current Pod: %w", err)
 	}
+	if identity.UID != "" && identity.UID != pod.UID {
+		return fmt.Errorf("pod %v has UID %s, expected %s", key, pod.UID, identity.UID)
+	}
+
+	if value, ok := pod.Annotations[AnnotationPriority]; ok {
+		priority, err := strconv.Atoi(value)
+		if err != nil || priority < 0 || priority > MaxPriority {
+			return fmt.Errorf("invalid priority annotation %q, must be between 0 and %d", value, MaxPriority)
+		}
+		c.Priority = priority
+	}
+
+	c.preferred, err = c.inPreferredTopology(ctx, pod)
+	if err != nil {
+		return err
+	}
+	if c.PreferredTopology != nil {
+		c.Logger.Infof("Running on Node %s, which is preferred: %t", pod.Spec.NodeName, c.preferred)
+	}
 
-	c.hostname = hostname
+	c.identity = identity.Name
+	c.self.Store(key)
 	c.ownerReference = &meta_v1.OwnerReference{
 		APIVersion: pod.APIVersion,
 		Kind:       pod.Kind,
 		Name:       pod.Name,
 		UID:        pod.UID,
 	}
+	c.setUp.Store(true)
 	c.Logger.Info("Candidate setup complete")
 
 	return nil
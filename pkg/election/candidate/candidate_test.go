@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/nais/elector/pkg/election"
+	"github.com/nais/elector/pkg/election/backend"
+	"github.com/nais/elector/pkg/metrics"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	coordination_v1 "k8s.io/api/coordination/v1"
 	core_v1 "k8s.io/api/core/v1"
 	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	k8s_runtime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -18,8 +23,12 @@ import (
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -38,7 +47,7 @@ type testRig struct {
 	manager         ctrl.Manager
 	hostname        string
 	candidate       Candidate
-	electionResults chan string
+	electionResults chan election.Result
 	fakeClock       testclock.FakeClock
 }
 
@@ -99,13 +108,17 @@ func newTestRig(t *testing.T) (*testRig, error) {
 	}
 	rig.hostname = hostname
 
-	rig.electionResults = make(chan string)
+	rig.electionResults = make(chan election.Result)
 
 	rig.fakeClock = testclock.FakeClock{}
 	logger := logrus.New()
 	logger.Level = logrus.DebugLevel
 	rig.candidate = Candidate{
-		Client:          rig.client,
+		Client: rig.client,
+		Config: Config{
+			Backend:      backend.NewLease(rig.client),
+			ResyncPeriod: time.Minute,
+		},
 		Clock:           &rig.fakeClock,
 		Logger:          logger,
 		ElectionResults: rig.electionResults,
@@ -113,6 +126,7 @@ func newTestRig(t *testing.T) (*testRig, error) {
 			Namespace: namespace,
 			Name:      electionName,
 		},
+		wake: make(chan event.GenericEvent, 1),
 	}
 
 	return rig, nil
@@ -192,10 +206,37 @@ func TestCandidate_WinSimpleElection(t *testing.T) {
 		t.Logf("Context closed while waiting for results: %v", ctx.Err())
 		t.FailNow()
 	case result := <-rig.electionResults:
-		assert.Equal(t, rig.hostname, result)
+		assert.Equal(t, rig.hostname, result.Leader)
 	}
 }
 
+func TestCandidate_WinElectionWithConfigMap(t *testing.T) {
+	rig, err := newTestRig(t)
+	if err != nil {
+		t.Errorf("unable to run controller integration tests: %s", err)
+		t.FailNow()
+	}
+
+	// Allow 15 seconds for test to complete
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	rig.candidate.Backend = backend.NewConfigMap(rig.client)
+	rig.commonSetupForTest(ctx)
+
+	run(t, rig, ctx)
+
+	select {
+	case <-ctx.Done():
+		t.Logf("Context closed while waiting for results: %v", ctx.Err())
+		t.FailNow()
+	case result := <-rig.electionResults:
+		assert.Equal(t, rig.hostname, result.Leader)
+	}
+	rig.assertExists(ctx, &core_v1.ConfigMap{}, rig.candidate.ElectionName)
+	rig.assertNotExists(ctx, &coordination_v1.Lease{}, rig.candidate.ElectionName)
+}
+
 func TestCandidate_WinRaceToElection(t *testing.T) {
 	rig, err := newTestRig(t)
 	if err != nil {
@@ -242,18 +283,996 @@ func TestCandidate_WinRaceToElection(t *testing.T) {
 		t.Logf("Context closed while waiting for results: %v", ctx.Err())
 		t.FailNow()
 	case result := <-rig.electionResults:
-		assert.Equal(t, notMe, result)
+		assert.Equal(t, notMe, result.Leader)
 		select {
 		case <-ctx.Done():
 			t.Logf("Context closed while waiting for results: %v", ctx.Err())
 			t.FailNow()
 		case result := <-rig.electionResults:
-			assert.Equal(t, rig.hostname, result)
+			assert.Equal(t, rig.hostname, result.Leader)
 		}
 	}
 }
 
+func TestCandidate_TakeOverExpiredLease(t *testing.T) {
+	rig, err := newTestRig(t)
+	if err != nil {
+		t.Errorf("unable to run controller integration tests: %s", err)
+		t.FailNow()
+	}
+
+	// Allow 15 seconds for test to complete
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	rig.candidate.Config = Config{
+		Backend:       rig.candidate.Backend,
+		Mode:          ModeRenewing,
+		LeaseDuration: 15 * time.Second,
+		RenewInterval: 5 * time.Second,
+	}
+	rig.fakeClock.SetTime(time.Now())
+
+	rig.commonSetupForTest(ctx)
+	lease := coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      rig.candidate.ElectionName.Name,
+			Namespace: rig.candidate.ElectionName.Namespace,
+		},
+		Spec: coordination_v1.LeaseSpec{
+			HolderIdentity:       pointer.String(notMe),
+			LeaseDurationSeconds: pointer.Int32(15),
+			RenewTime: &meta_v1.MicroTime{
+				Time: rig.fakeClock.Now().Add(-time.Minute),
+			},
+		},
+	}
+	rig.createForTest(ctx, &lease)
+
+	run(t, rig, ctx)
+
+	select {
+	case <-ctx.Done():
+		t.Logf("Context closed while waiting for results: %v", ctx.Err())
+		t.FailNow()
+	case result := <-rig.electionResults:
+		assert.Equal(t, rig.hostname, result.Leader)
+	}
+
+	actual := &coordination_v1.Lease{}
+	rig.assertExists(ctx, actual, rig.candidate.ElectionName)
+	assert.Equal(t, rig.hostname, *actual.Spec.HolderIdentity)
+	assert.Equal(t, int32(1), *actual.Spec.LeaseTransitions)
+}
+
+func TestCandidate_ReleaseLeadership(t *testing.T) {
+	rig, err := newTestRig(t)
+	if err != nil {
+		t.Errorf("unable to run controller integration tests: %s", err)
+		t.FailNow()
+	}
+
+	// Allow 15 seconds for test to complete
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	rig.commonSetupForTest(ctx)
+
+	run(t, rig, ctx)
+
+	select {
+	case <-ctx.Done():
+		t.Logf("Context closed while waiting for results: %v", ctx.Err())
+		t.FailNow()
+	case result := <-rig.electionResults:
+		assert.Equal(t, rig.hostname, result.Leader)
+	}
+
+	err = rig.candidate.Release(ctx)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		err := rig.client.Get(ctx, rig.candidate.ElectionName, &coordination_v1.Lease{})
+		return k8s_errors.IsNotFound(err)
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestCandidate_TakeOverPinnedLeadership(t *testing.T) {
+	rig, err := newTestRig(t)
+	if err != nil {
+		t.Errorf("unable to run controller integration tests: %s", err)
+		t.FailNow()
+	}
+
+	// Allow 15 seconds for test to complete
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	rig.commonSetupForTest(ctx)
+	lease := coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      rig.candidate.ElectionName.Name,
+			Namespace: rig.candidate.ElectionName.Namespace,
+			Annotations: map[string]string{
+				AnnotationPinnedHolder: rig.hostname,
+			},
+		},
+		Spec: coordination_v1.LeaseSpec{
+			HolderIdentity: pointer.String(notMe),
+			AcquireTime: &meta_v1.MicroTime{
+				Time: time.Now(),
+			},
+		},
+	}
+	rig.createForTest(ctx, &lease)
+
+	run(t, rig, ctx)
+
+	select {
+	case <-ctx.Done():
+		t.Logf("Context closed while waiting for results: %v", ctx.Err())
+		t.FailNow()
+	case result := <-rig.electionResults:
+		assert.Equal(t, rig.hostname, result.Leader)
+		assert.True(t, result.Pinned)
+	}
+}
+
+func TestCandidate_ObserveWithoutCampaigning(t *testing.T) {
+	rig, err := newTestRig(t)
+	if err != nil {
+		t.Errorf("unable to run controller integration tests: %s", err)
+		t.FailNow()
+	}
+
+	// Allow 15 seconds for test to complete
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	rig.candidate.Observer = true
+
+	// Observers don't need a Pod, so only the namespace is created
+	rig.createForTest(ctx, &core_v1.Namespace{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name: namespace,
+		},
+	})
+
+	run(t, rig, ctx)
+
+	select {
+	case <-ctx.Done():
+		t.Logf("Context closed while waiting for results: %v", ctx.Err())
+		t.FailNow()
+	case result := <-rig.electionResults:
+		assert.Equal(t, "", result.Leader)
+	}
+	rig.assertNotExists(ctx, &coordination_v1.Lease{}, rig.candidate.ElectionName)
+	assert.NoError(t, rig.candidate.readyz(nil))
+}
+
+func TestCandidate_Resync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	fakeClock := testclock.NewFakeClock(time.Now())
+	c := &Candidate{
+		Config: Config{
+			Backend:      backend.NewFile(t.TempDir()),
+			Observer:     true,
+			ResyncPeriod: time.Minute,
+		},
+		Clock:  fakeClock,
+		Logger: logrus.New(),
+		ElectionName: types.NamespacedName{
+			Namespace: namespace,
+			Name:      electionName,
+		},
+		wake: make(chan event.GenericEvent, 1),
+	}
+	go func() {
+		if err := c.Start(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("candidate errored out: %v", err)
+		}
+	}()
+
+	// The election is queued for a check at start, and then on every tick
+	for tick := 0; tick < 3; tick++ {
+		if tick > 0 {
+			assert.Eventually(t, fakeClock.HasWaiters, 5*time.Second, 10*time.Millisecond)
+			fakeClock.Step(time.Minute)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Context closed while waiting for a check after %d ticks: %v", tick, ctx.Err())
+		case wake := <-c.wake:
+			assert.Equal(t, electionName, wake.Object.GetName())
+		}
+	}
+	cancel()
+}
+
+func TestCandidate_IdentitySource(t *testing.T) {
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	c := &Candidate{}
+	identity, err := c.identitySource().Identity()
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{Name: hostname}, identity)
+
+	c.Local = true
+	identity, err = c.identitySource().Identity()
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s-%d", hostname, os.Getpid()), identity.Name)
+
+	c.IdentitySource = StaticIdentity{Name: "explicit"}
+	identity, err = c.identitySource().Identity()
+	assert.NoError(t, err)
+	assert.Equal(t, "explicit", identity.Name)
+
+	t.Setenv("POD_NAME", "")
+	_, err = DownwardAPIIdentity{}.Identity()
+	assert.Error(t, err)
+
+	t.Setenv("POD_NAME", "pod")
+	t.Setenv("POD_UID", "uid")
+	identity, err = DownwardAPIIdentity{}.Identity()
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{Name: "pod", UID: "uid"}, identity)
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		name    string
+		spec    coordination_v1.LeaseSpec
+		expires bool
+		expiry  time.Time
+	}{
+		{
+			name:    "no duration never expires",
+			spec:    coordination_v1.LeaseSpec{AcquireTime: &meta_v1.MicroTime{Time: now}},
+			expires: false,
+		},
+		{
+			name: "expires after renew time",
+			spec: coordination_v1.LeaseSpec{
+				AcquireTime:          &meta_v1.MicroTime{Time: now.Add(-time.Hour)},
+				RenewTime:            &meta_v1.MicroTime{Time: now},
+				LeaseDurationSeconds: pointer.Int32(10),
+			},
+			expires: true,
+			expiry:  now.Add(10 * time.Second),
+		},
+		{
+			name: "falls back to acquire time",
+			spec: coordination_v1.LeaseSpec{
+				AcquireTime:          &meta_v1.MicroTime{Time: now},
+				LeaseDurationSeconds: pointer.Int32(10),
+			},
+			expires: true,
+			expiry:  now.Add(10 * time.Second),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			expiry, expires := leaseExpiry(&coordination_v1.Lease{Spec: tt.spec})
+			assert.Equal(t, tt.expires, expires)
+			assert.Equal(t, tt.expiry, expiry)
+		})
+	}
+}
+
+func TestCandidate_CampaignDelay(t *testing.T) {
+	now := time.Now()
+	c := &Candidate{
+		Clock: testclock.NewFakeClock(now),
+		Config: Config{
+			PriorityBackoff: time.Second,
+		},
+	}
+
+	c.Priority = MaxPriority
+	assert.Equal(t, time.Duration(0), c.campaignDelay())
+
+	c.Priority = MaxPriority - 3
+	assert.Equal(t, 3*time.Second, c.campaignDelay())
+
+	c.holdoffUntil = now.Add(preemptionHoldoff)
+	assert.Equal(t, preemptionHoldoff, c.campaignDelay())
+}
+
+func TestCandidate_CampaignWait(t *testing.T) {
+	clock := testclock.NewFakeClock(time.Now())
+	results := make(chan election.Result, 10)
+	kubernetes := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	c := &Candidate{
+		Client:          kubernetes,
+		Clock:           clock,
+		Logger:          logrus.New(),
+		ElectionResults: results,
+		ElectionName:    types.NamespacedName{Namespace: "default", Name: "wait"},
+		Config: Config{
+			Backend:         backend.NewLease(kubernetes),
+			Local:           true,
+			Priority:        MaxPriority - 3,
+			PriorityBackoff: time.Second,
+		},
+		identity: "me",
+	}
+	c.setUp.Store(true)
+	ctx := context.Background()
+
+	// The wait is handed back to controller-runtime, instead of holding up the check
+	result, err := c.checkLease(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 3 * time.Second}, result)
+
+	// Checks during the wait don't start it over
+	clock.Step(2 * time.Second)
+	result, err = c.checkLease(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: time.Second}, result)
+
+	clock.Step(time.Second)
+	_, err = c.checkLease(ctx)
+	assert.NoError(t, err)
+	lease, err := c.getLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, c.isHolder(lease))
+
+	// The next time the election has no leader, the wait starts from the beginning
+	assert.Equal(t, 3*time.Second, c.campaignWait())
+}
+
+func TestCandidate_TakeOverDeletedLease(t *testing.T) {
+	kubernetes := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	c := &Candidate{
+		Client:       kubernetes,
+		Clock:        testclock.NewFakeClock(time.Now()),
+		Logger:       logrus.New(),
+		ElectionName: types.NamespacedName{Namespace: "default", Name: "deleted"},
+		Config: Config{
+			Backend: backend.NewLease(kubernetes),
+			Local:   true,
+		},
+		identity: "me",
+	}
+	expired := &coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "deleted", ResourceVersion: "1"},
+		Spec:       coordination_v1.LeaseSpec{HolderIdentity: pointer.String("other")},
+	}
+	conflicts := func() float64 {
+		metric := &dto.Metric{}
+		assert.NoError(t, metrics.CampaignConflicts.WithLabelValues(metrics.CampaignTakeover).Write(metric))
+		return metric.GetCounter().GetValue()
+	}
+	before := conflicts()
+
+	// Nobody wrote the Lease first, so it isn't a conflict, and there is no leader until we campaign
+	lease, err := c.takeOverLease(context.Background(), expired)
+	assert.NoError(t, err)
+	assert.Nil(t, lease)
+	assert.Equal(t, before, conflicts())
+}
+
+func TestCandidate_Jitter(t *testing.T) {
+	c := &Candidate{
+		Clock: testclock.NewFakeClock(time.Now()),
+	}
+	assert.Equal(t, time.Duration(0), c.jitter())
+
+	c.CampaignJitter = time.Second
+	for i := 0; i < 100; i++ {
+		delay := c.campaignDelay()
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.Less(t, delay, time.Second)
+	}
+}
+
+func TestCandidate_RetryLimiter(t *testing.T) {
+	c := &Candidate{
+		Config: Config{
+			RetryBackoff:    time.Second,
+			RetryBackoffMax: 4 * time.Second,
+		},
+	}
+	limiter := c.retryLimiter()
+	request := reconcile.Request{}
+
+	for _, base := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		delay := limiter.When(request)
+		assert.GreaterOrEqual(t, delay, base)
+		assert.LessOrEqual(t, delay, base+base/2)
+	}
+	limiter.Forget(request)
+	assert.Less(t, limiter.When(request), 2*time.Second)
+}
+
+func TestLeasePriority(t *testing.T) {
+	lease := &coordination_v1.Lease{}
+	assert.Equal(t, 0, leasePriority(lease))
+
+	lease.Annotations = map[string]string{AnnotationPriority: "7"}
+	assert.Equal(t, 7, leasePriority(lease))
+
+	lease.Annotations[AnnotationPriority] = "garbage"
+	assert.Equal(t, 0, leasePriority(lease))
+}
+
+func TestCandidate_Topology(t *testing.T) {
+	c := &Candidate{
+		Clock: testclock.NewFakeClock(time.Now()),
+		Config: Config{
+			TopologyBackoff: 5 * time.Second,
+			Rebalance:       true,
+		},
+	}
+	lease := &coordination_v1.Lease{ObjectMeta: meta_v1.ObjectMeta{Annotations: map[string]string{}}}
+
+	// Without a preference, there is no delay and nothing to rebalance
+	assert.Equal(t, time.Duration(0), c.campaignDelay())
+	c.setPreferred(lease)
+	assert.NotContains(t, lease.Annotations, AnnotationPreferred)
+	assert.False(t, c.rebalance(lease))
+
+	c.PreferredTopology = labels.SelectorFromSet(labels.Set{"topology.kubernetes.io/zone": "a"})
+	assert.Equal(t, 5*time.Second, c.campaignDelay())
+	c.setPreferred(lease)
+	assert.False(t, leasePreferred(lease))
+	assert.False(t, c.rebalance(lease))
+
+	c.preferred = true
+	assert.Equal(t, time.Duration(0), c.campaignDelay())
+	assert.True(t, c.rebalance(lease))
+	assert.True(t, c.shouldPreempt(lease))
+	c.setPreferred(lease)
+	assert.True(t, leasePreferred(lease))
+	assert.False(t, c.rebalance(lease))
+
+	// Leases from before topology preference are left alone
+	assert.True(t, leasePreferred(&coordination_v1.Lease{}))
+}
+
+func TestCandidate_RebalanceWithPreemption(t *testing.T) {
+	topology := labels.SelectorFromSet(labels.Set{"topology.kubernetes.io/zone": "a"})
+	candidate := func(priority int, preferred bool) *Candidate {
+		return &Candidate{
+			Config: Config{
+				Priority:          priority,
+				Preemption:        true,
+				PreferredTopology: topology,
+				Rebalance:         true,
+			},
+			preferred: preferred,
+		}
+	}
+	leaseOf := func(c *Candidate) *coordination_v1.Lease {
+		lease := &coordination_v1.Lease{ObjectMeta: meta_v1.ObjectMeta{Annotations: map[string]string{
+			AnnotationPriority: strconv.Itoa(c.Priority),
+		}}}
+		c.setPreferred(lease)
+		return lease
+	}
+	preferred, important := candidate(1, true), candidate(5, false)
+
+	// The candidate with the higher priority wins, wherever it runs, and isn't rebalanced away
+	assert.True(t, important.shouldPreempt(leaseOf(preferred)))
+	assert.False(t, preferred.shouldPreempt(leaseOf(important)))
+
+	// Between equals, the preferred topology wins
+	equal := candidate(5, true)
+	assert.True(t, equal.shouldPreempt(leaseOf(important)))
+	assert.False(t, important.shouldPreempt(leaseOf(equal)))
+}
+
+func TestCandidate_RenewDeadline(t *testing.T) {
+	clock := testclock.NewFakeClock(time.Now())
+	results := make(chan election.Result, 1)
+	c := &Candidate{
+		Clock:           clock,
+		Logger:          logrus.New(),
+		ElectionResults: results,
+		ElectionName:    types.NamespacedName{Namespace: "default", Name: "renew"},
+		Config: Config{
+			Mode:          ModeRenewing,
+			LeaseDuration: 15 * time.Second,
+			RenewInterval: 5 * time.Second,
+		},
+		identity: "me",
+	}
+	unreachable := errors.New("unreachable")
+
+	// Errors are returned as they are when we don't lead
+	_, err := c.checkRenewDeadline(unreachable)
+	assert.ErrorIs(t, err, unreachable)
+
+	renewed := meta_v1.NewMicroTime(clock.Now())
+	c.observeRenewal(&coordination_v1.Lease{Spec: coordination_v1.LeaseSpec{HolderIdentity: pointer.String("me"), RenewTime: &renewed}})
+
+	// The leader keeps leading, and tries again in time to renew the Lease before it expires
+	result, err := c.checkRenewDeadline(unreachable)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 5 * time.Second}, result)
+	clock.Step(12 * time.Second)
+	result, err = c.checkRenewDeadline(unreachable)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 3 * time.Second}, result)
+	assert.Empty(t, results)
+
+	// Once the Lease has expired, someone else may lead
+	clock.Step(3 * time.Second)
+	_, err = c.checkRenewDeadline(unreachable)
+	assert.ErrorIs(t, err, unreachable)
+	assert.Equal(t, election.Result{Identity: "me"}, <-results)
+	_, err = c.checkRenewDeadline(unreachable)
+	assert.ErrorIs(t, err, unreachable)
+	assert.Empty(t, results)
+}
+
+func TestCandidate_MinTenure(t *testing.T) {
+	clock := testclock.NewFakeClock(time.Now())
+	c := &Candidate{Clock: clock}
+	acquired := meta_v1.NewMicroTime(clock.Now())
+	lease := &coordination_v1.Lease{Spec: coordination_v1.LeaseSpec{AcquireTime: &acquired}}
+
+	assert.Equal(t, time.Duration(0), c.tenureRemaining(lease))
+
+	c.MinTenure = time.Minute
+	assert.Equal(t, time.Minute, c.tenureRemaining(lease))
+	clock.Step(45 * time.Second)
+	assert.Equal(t, 15*time.Second, c.tenureRemaining(lease))
+	clock.Step(time.Minute)
+	assert.LessOrEqual(t, c.tenureRemaining(lease), time.Duration(0))
+
+	// Leases without an acquire time have nothing to serve
+	assert.Equal(t, time.Duration(0), c.tenureRemaining(&coordination_v1.Lease{}))
+}
+
+func TestCandidate_TransitionBreaker(t *testing.T) {
+	clock := testclock.NewFakeClock(time.Now())
+	c := &Candidate{
+		Clock:        clock,
+		Logger:       logrus.New(),
+		ElectionName: types.NamespacedName{Namespace: "default", Name: "breaker"},
+		Config: Config{
+			TransitionLimit:  2,
+			TransitionWindow: time.Minute,
+		},
+	}
+
+	// The term that is current when we start doesn't count, and neither does seeing it again
+	c.observeTransition(1)
+	c.observeTransition(1)
+	_, frozen := c.frozen()
+	assert.False(t, frozen)
+
+	start := clock.Now()
+	for epoch := int64(2); epoch <= 3; epoch++ {
+		c.observeTransition(epoch)
+		clock.Step(10 * time.Second)
+	}
+	_, frozen = c.frozen()
+	assert.False(t, frozen)
+
+	c.observeTransition(4)
+	until, frozen := c.frozen()
+	assert.True(t, frozen)
+	assert.True(t, c.isFrozen())
+	assert.Equal(t, start.Add(time.Minute), until)
+
+	// Thaws once the oldest transition is outside the window
+	clock.SetTime(until)
+	_, frozen = c.frozen()
+	assert.False(t, frozen)
+	assert.False(t, c.isFrozen())
+
+	// Disabled without a limit
+	c.TransitionLimit = 0
+	for epoch := int64(5); epoch <= 10; epoch++ {
+		c.observeTransition(epoch)
+	}
+	_, frozen = c.frozen()
+	assert.False(t, frozen)
+}
+
+func TestCandidate_FrozenWithoutLeader(t *testing.T) {
+	clock := testclock.NewFakeClock(time.Now())
+	kubernetes := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	c := &Candidate{
+		Client:          kubernetes,
+		Clock:           clock,
+		Logger:          logrus.New(),
+		ElectionResults: make(chan election.Result, 10),
+		ElectionName:    types.NamespacedName{Namespace: "default", Name: "frozen"},
+		Config: Config{
+			Backend:          backend.NewLease(kubernetes),
+			Local:            true,
+			Mode:             ModeRenewing,
+			LeaseDuration:    15 * time.Second,
+			RenewInterval:    5 * time.Second,
+			TransitionLimit:  1,
+			TransitionWindow: time.Hour,
+		},
+		identity: "me",
+	}
+	c.setUp.Store(true)
+	for epoch := int64(1); epoch <= 3; epoch++ {
+		c.observeTransition(epoch)
+	}
+	ctx := context.Background()
+
+	// A live leader is left alone
+	now := meta_v1.NewMicroTime(clock.Now())
+	live := &coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "frozen"},
+		Spec: coordination_v1.LeaseSpec{
+			HolderIdentity:       pointer.String("other"),
+			RenewTime:            &now,
+			LeaseDurationSeconds: pointer.Int32(15),
+		},
+	}
+	assert.NoError(t, c.Backend.Acquire(ctx, live))
+	_, err := c.checkLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, c.isFrozen())
+	lease, err := c.getLease(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "other", holder(lease))
+
+	// One that has expired is taken over
+	clock.Step(time.Minute)
+	_, err = c.checkLease(ctx)
+	assert.NoError(t, err)
+	lease, err = c.getLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, c.isHolder(lease))
+
+	// Without a Lease, we campaign for it
+	assert.NoError(t, c.Backend.Release(ctx, lease))
+	_, err = c.checkLease(ctx)
+	assert.NoError(t, err)
+	lease, err = c.getLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, c.isHolder(lease))
+	assert.True(t, c.isFrozen())
+}
+
+func TestCandidate_Unhealthy(t *testing.T) {
+	now := time.Now()
+	c := &Candidate{
+		Clock: testclock.NewFakeClock(now),
+		Config: Config{
+			EvictNotReadyAfter:        time.Minute,
+			EvictRestartingAfter:      time.Minute,
+			EvictRestartingContainers: []string{"app"},
+		},
+	}
+
+	notReady := &core_v1.Pod{
+		Status: core_v1.PodStatus{
+			Conditions: []core_v1.PodCondition{{
+				Type:               core_v1.PodReady,
+				Status:             core_v1.ConditionFalse,
+				LastTransitionTime: meta_v1.NewTime(now.Add(-45 * time.Second)),
+			}},
+		},
+	}
+	reason, remaining := c.unhealthy(notReady)
+	assert.Equal(t, EvictionReasonNotReady, reason)
+	assert.Equal(t, 15*time.Second, remaining)
+
+	crashing := &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{UID: testUID},
+		Status: core_v1.PodStatus{
+			ContainerStatuses: []core_v1.ContainerStatus{
+				{Name: "elector", Ready: true},
+				{Name: "app", RestartCount: 3},
+			},
+		},
+	}
+	reason, remaining = c.unhealthy(crashing)
+	assert.Equal(t, EvictionReasonRestarting, reason)
+	assert.Equal(t, time.Minute, remaining)
+
+	c.Clock.(*testclock.FakeClock).Step(2 * time.Minute)
+	reason, remaining = c.unhealthy(crashing)
+	assert.Equal(t, EvictionReasonRestarting, reason)
+	assert.Equal(t, -time.Minute, remaining)
+
+	crashing.Status.ContainerStatuses[1].Ready = true
+	reason, _ = c.unhealthy(crashing)
+	assert.Equal(t, "", reason)
+}
+
+func TestCandidate_IneligibleWhileRestarting(t *testing.T) {
+	pod := &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "me", UID: testUID},
+		Status: core_v1.PodStatus{
+			ContainerStatuses: []core_v1.ContainerStatus{{Name: "app", RestartCount: 3}},
+		},
+	}
+	kubernetes := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod).Build()
+	c := &Candidate{
+		Client:       kubernetes,
+		Clock:        testclock.NewFakeClock(time.Now()),
+		ElectionName: types.NamespacedName{Namespace: "default", Name: "restarting"},
+		Config: Config{
+			EvictRestartingAfter: time.Minute,
+		},
+		identity: "me",
+	}
+	ctx := context.Background()
+
+	// A leader gets to recover, but an evicted leader that is still restarting can't win again
+	reason, err := c.ineligible(ctx, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+	reason, err = c.ineligible(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "is "+EvictionReasonRestarting, reason)
+
+	pod.Status.ContainerStatuses[0].Ready = true
+	assert.NoError(t, kubernetes.Status().Update(ctx, pod))
+	reason, err = c.ineligible(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestCandidate_IneligibleReason(t *testing.T) {
+	selector, err := labels.Parse("role=worker")
+	assert.NoError(t, err)
+	c := &Candidate{
+		Config: Config{
+			RequireReady:     true,
+			EligibleSelector: selector,
+			ContainerName:    "elector",
+		},
+	}
+	pod := &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Labels: map[string]string{"role": "worker"},
+		},
+		Status: core_v1.PodStatus{
+			ContainerStatuses: []core_v1.ContainerStatus{
+				{Name: "app", Ready: true},
+				{Name: "elector", Ready: false},
+			},
+		},
+	}
+	assert.Equal(t, "", c.ineligibleReason(pod))
+
+	pod.Status.ContainerStatuses[0].Ready = false
+	assert.Equal(t, "is not ready", c.ineligibleReason(pod))
+	pod.Status.ContainerStatuses[0].Ready = true
+
+	pod.Labels["role"] = "dashboard"
+	assert.Contains(t, c.ineligibleReason(pod), "does not match the selector")
+	pod.Labels["role"] = "worker"
+
+	pod.Annotations = map[string]string{AnnotationIneligible: "true"}
+	assert.Contains(t, c.ineligibleReason(pod), AnnotationIneligible)
+
+	pod.Annotations[AnnotationIneligible] = "false"
+	assert.Equal(t, "", c.ineligibleReason(pod))
+}
+
+func TestCandidate_Epoch(t *testing.T) {
+	now := time.UnixMilli(1000)
+	c := &Candidate{
+		Clock: testclock.NewFakeClock(now),
+	}
+
+	lease := &coordination_v1.Lease{}
+	assert.Equal(t, int64(0), leaseEpoch(lease))
+	assert.Equal(t, int64(1000), c.nextEpoch(lease))
+
+	lease.Spec.LeaseTransitions = pointer.Int32(3)
+	assert.Equal(t, int64(3), leaseEpoch(lease))
+
+	lease.Annotations = map[string]string{AnnotationEpoch: "5000"}
+	assert.Equal(t, int64(5000), c.observeEpoch(lease))
+	assert.Equal(t, int64(5001), c.nextEpoch(lease))
+
+	// A new Lease continues from the highest epoch seen, even if the clock is behind
+	assert.Equal(t, int64(5001), c.nextEpoch(&coordination_v1.Lease{}))
+}
+
+func TestCandidate_EpochAfterDelete(t *testing.T) {
+	kubernetes := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	candidate := func(identity string, now time.Time) *Candidate {
+		c := &Candidate{
+			Client:          kubernetes,
+			Clock:           testclock.NewFakeClock(now),
+			Logger:          logrus.New(),
+			ElectionResults: make(chan election.Result, 10),
+			ElectionName:    types.NamespacedName{Namespace: "default", Name: "epoch"},
+			Config: Config{
+				Backend: backend.NewLease(kubernetes),
+				Local:   true,
+			},
+			identity: identity,
+		}
+		c.setUp.Store(true)
+		return c
+	}
+	ctx := context.Background()
+
+	first := candidate("first", time.UnixMilli(5000))
+	_, err := first.checkLease(ctx)
+	assert.NoError(t, err)
+	lease, err := first.getLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, first.isHolder(lease))
+	assert.Equal(t, int64(5000), leaseEpoch(lease))
+
+	// The Lease is gone, and the next leader has never seen it and has a clock that is behind
+	assert.NoError(t, first.Backend.Release(ctx, lease))
+	second := candidate("second", time.UnixMilli(1000))
+	_, err = second.checkLease(ctx)
+	assert.NoError(t, err)
+	lease, err = second.getLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, second.isHolder(lease))
+	assert.Equal(t, int64(5001), leaseEpoch(lease))
+}
+
+func TestCandidate_HolderInAnotherNamespace(t *testing.T) {
+	c := &Candidate{
+		ElectionName: types.NamespacedName{Namespace: "elections", Name: "central"},
+		Config: Config{
+			PodNamespace: "team-a",
+		},
+		identity:       "worker-0",
+		ownerReference: &meta_v1.OwnerReference{Name: "worker-0", UID: "uid-a"},
+	}
+	lease := &coordination_v1.Lease{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Annotations: map[string]string{
+				AnnotationHolderNamespace: "team-a",
+				AnnotationHolderUID:       "uid-a",
+			},
+		},
+		Spec: coordination_v1.LeaseSpec{HolderIdentity: pointer.String("worker-0")},
+	}
+	assert.True(t, c.isHolder(lease))
+
+	// A Pod with the same name in another namespace
+	lease.Annotations[AnnotationHolderNamespace] = "team-b"
+	assert.False(t, c.isHolder(lease))
+
+	// A previous Pod with the same name
+	lease.Annotations[AnnotationHolderNamespace] = "team-a"
+	lease.Annotations[AnnotationHolderUID] = "uid-old"
+	assert.False(t, c.isHolder(lease))
+
+	// Only events for our Pod and the leader Pod in its own namespace are of interest
+	c.self.Store(types.NamespacedName{Namespace: "team-a", Name: "worker-0"})
+	c.leader.Store(types.NamespacedName{Namespace: "team-b", Name: "worker-1"})
+	pod := func(namespace, name string) *core_v1.Pod {
+		return &core_v1.Pod{ObjectMeta: meta_v1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	assert.NotEmpty(t, c.mapPod(context.Background(), pod("team-b", "worker-1")))
+	assert.Empty(t, c.mapPod(context.Background(), pod("team-a", "worker-1")))
+	assert.NotEmpty(t, c.mapPod(context.Background(), pod("team-a", "worker-0")))
+}
+
+func TestSemaphore_RecheckWhenSlotReleased(t *testing.T) {
+	kubernetes := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	group := &slotGroup{held: make(map[int]bool)}
+	for slot := 0; slot < 2; slot++ {
+		c := &Candidate{
+			Client:          kubernetes,
+			Clock:           testclock.NewFakeClock(time.Now()),
+			Logger:          logrus.New(),
+			ElectionResults: make(chan election.Result, 10),
+			ElectionName:    types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("semaphore-%d", slot)},
+			Config: Config{
+				Backend: backend.NewLease(kubernetes),
+				Local:   true,
+			},
+			identity: "me",
+			slot:     slot,
+			slots:    group,
+			wake:     make(chan event.GenericEvent, 1),
+		}
+		c.setUp.Store(true)
+		group.candidates = append(group.candidates, c)
+	}
+	first, second := group.candidates[0], group.candidates[1]
+	ctx := context.Background()
+
+	_, err := first.checkLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, group.held[0])
+
+	// Holding the first slot, we leave the second one vacant
+	_, err = second.checkLease(ctx)
+	assert.NoError(t, err)
+	lease, err := second.getLease(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, lease)
+	assert.Empty(t, second.wake)
+
+	// Once we lose the first slot, the second is checked again, and we take it
+	lease, err = first.getLease(ctx)
+	assert.NoError(t, err)
+	lease.Spec.HolderIdentity = pointer.String("other")
+	assert.NoError(t, first.Backend.Update(ctx, lease))
+	_, err = first.checkLease(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, second.wake, 1)
+	assert.Empty(t, first.wake)
+
+	_, err = second.checkLease(ctx)
+	assert.NoError(t, err)
+	assert.True(t, group.held[1])
+}
+
+func TestSemaphore_Combine(t *testing.T) {
+	s := &semaphore{}
+
+	combined := s.combine([]election.Result{
+		{Leader: "other", Identity: "me", Epoch: 1},
+		{},
+		{Leader: "me", Identity: "me", Epoch: 3},
+	})
+	assert.Equal(t, "me", combined.Leader)
+	assert.Equal(t, "me", combined.Identity)
+	assert.Equal(t, int64(3), combined.Epoch)
+	assert.Equal(t, pointer.Int(2), combined.Slot)
+	assert.Equal(t, []string{"other", "", "me"}, combined.Holders)
+
+	combined = s.combine([]election.Result{
+		{},
+		{Leader: "other", Epoch: 2},
+		{Leader: "third", Epoch: 3},
+	})
+	assert.Equal(t, "other", combined.Leader)
+	assert.Equal(t, int64(2), combined.Epoch)
+	assert.Nil(t, combined.Slot)
+}
+
+func TestCandidate_SetOwnership(t *testing.T) {
+	c := &Candidate{
+		ElectionName:   types.NamespacedName{Namespace: "central", Name: "election"},
+		ownerReference: &meta_v1.OwnerReference{Name: "me", UID: "uid"},
+	}
+
+	lease := &coordination_v1.Lease{ObjectMeta: meta_v1.ObjectMeta{Annotations: map[string]string{}}}
+	c.setOwnership(lease)
+	assert.Len(t, lease.OwnerReferences, 1)
+	assert.Equal(t, "central", holderNamespace(lease, "central"))
+
+	c.PodNamespace = "team"
+	c.setOwnership(lease)
+	assert.Empty(t, lease.OwnerReferences)
+	assert.Equal(t, "team", holderNamespace(lease, "central"))
+	assert.Equal(t, "uid", lease.Annotations[AnnotationHolderUID])
+
+	assert.Equal(t, "central", holderNamespace(&coordination_v1.Lease{}, "central"))
+}
+
+func TestEarliest(t *testing.T) {
+	assert.Equal(t, ctrl.Result{}, earliest(ctrl.Result{}, ctrl.Result{}))
+	assert.Equal(t, ctrl.Result{RequeueAfter: time.Second}, earliest(ctrl.Result{}, ctrl.Result{RequeueAfter: time.Second}))
+	assert.Equal(t, ctrl.Result{RequeueAfter: time.Second}, earliest(ctrl.Result{RequeueAfter: time.Minute}, ctrl.Result{RequeueAfter: time.Second}))
+	assert.Equal(t, ctrl.Result{Requeue: true}, earliest(ctrl.Result{Requeue: true}, ctrl.Result{RequeueAfter: time.Second}))
+}
+
 func run(t *testing.T, rig *testRig, ctx context.Context) {
+	// Checks the candidate asks for are run one at a time, like the controller would
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-rig.candidate.wake:
+				if _, err := rig.candidate.checkLease(ctx); err != nil && ctx.Err() == nil {
+					t.Logf("Check of %v failed: %v", rig.candidate.ElectionName, err)
+				}
+			}
+		}
+	}()
 	go func() {
 		err := rig.candidate.Start(ctx)
 		switch {
@@ -0,0 +1,60 @@
+package candidate
+
+import (
+	"context"
+	"fmt"
+
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AnnotationIneligible on a candidate Pod stops it from campaigning, and makes it step down if it is leader.
+const AnnotationIneligible = "elector.nais.io/ineligible"
+
+// ineligible returns why our Pod may not be leader, or an empty string if it may. holding tells whether we are leader.
+func (c *Candidate) ineligible(ctx context.Context, holding bool) (string, error) {
+	pod, err := c.getOwnPod(ctx)
+	if err != nil || pod == nil {
+		return "", err
+	}
+	if reason := c.ineligibleReason(pod); reason != "" {
+		return reason, nil
+	}
+	if c.evictionEnabled() {
+		// Don't let a leader that was evicted for being unhealthy win again. We only start counting restarts
+		// when we first see them, so an evicted leader would have a fresh allowance, and may only campaign
+		// once its containers are ready again.
+		reason, remaining := c.unhealthy(pod)
+		if reason != "" && (remaining <= 0 || (!holding && reason == EvictionReasonRestarting)) {
+			return "is " + reason, nil
+		}
+	}
+	return "", nil
+}
+
+func (c *Candidate) ineligibleReason(pod *core_v1.Pod) string {
+	if value, ok := pod.Annotations[AnnotationIneligible]; ok && value != "false" {
+		return fmt.Sprintf("has the %s annotation", AnnotationIneligible)
+	}
+	if c.EligibleSelector != nil && !c.EligibleSelector.Matches(labels.Set(pod.Labels)) {
+		return fmt.Sprintf("does not match the selector %q", c.EligibleSelector.String())
+	}
+	if c.RequireReady && !containersReady(pod, c.ContainerName) {
+		return "is not ready"
+	}
+	return ""
+}
+
+// containersReady reports whether all containers except the excluded one are ready.
+// The elector container is excluded, as it isn't ready until there is a leader.
+func containersReady(pod *core_v1.Pod, exclude string) bool {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != exclude && !status.Ready {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package candidate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+
+	"github.com/nais/elector/pkg/election/backend"
+)
+
+// AnnotationEpoch records the epoch of the current leadership term on the Lease.
+const AnnotationEpoch = backend.AnnotationEpoch
+
+// nextEpoch returns the epoch for a new leadership term. The Lease is deleted whenever leadership is
+// released, so we can't rely on counting alone. Instead, the epoch is at least the current time in
+// milliseconds, and always above any epoch we have seen before.
+func (c *Candidate) nextEpoch(lease *coordination_v1.Lease) int64 {
+	return max(leaseEpoch(lease)+1, c.lastEpoch.Load()+1, c.Clock.Now().UnixMilli())
+}
+
+// reserveEpoch returns nextEpoch, raised above every epoch reserved before if the backend keeps them. Without that,
+// a candidate that has never seen the previous term could start one with a lower epoch if its clock is behind.
+func (c *Candidate) reserveEpoch(ctx context.Context, lease *coordination_v1.Lease) (int64, error) {
+	epoch := c.nextEpoch(lease)
+	epochs, ok := c.Backend.(backend.Epochs)
+	if !ok {
+		return epoch, nil
+	}
+	epoch, err := epochs.ReserveEpoch(ctx, c.ElectionName, epoch)
+	if err != nil {
+		return 0, fmt.Errorf("unable to reserve epoch for %v: %w", c.ElectionName, err)
+	}
+	return epoch, nil
+}
+
+// observeEpoch returns the epoch of the Lease, and remembers it as the highest epoch seen if it is.
+func (c *Candidate) observeEpoch(lease *coordination_v1.Lease) int64 {
+	epoch := leaseEpoch(lease)
+	for {
+		last := c.lastEpoch.Load()
+		if epoch <= last || c.lastEpoch.CompareAndSwap(last, epoch) {
+			return epoch
+		}
+	}
+}
+
+// leaseEpoch returns the epoch recorded on the Lease. Leases from older versions of elector
+// don't have one, so we fall back to the number of transitions.
+func leaseEpoch(lease *coordination_v1.Lease) int64 {
+	epoch, err := strconv.ParseInt(lease.Annotations[AnnotationEpoch], 10, 64)
+	if err == nil {
+		return epoch
+	}
+	if lease.Spec.LeaseTransitions != nil {
+		return int64(*lease.Spec.LeaseTransitions)
+	}
+	return 0
+}
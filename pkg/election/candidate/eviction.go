@@ -0,0 +1,134 @@
+package candidate
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	core_v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/nais/elector/pkg/metrics"
+)
+
+const (
+	EvictionReasonNotReady   = "not-ready"
+	EvictionReasonRestarting = "restarting"
+)
+
+// healthTracker remembers when we first saw containers restarting, as the Pod status doesn't tell us.
+type healthTracker struct {
+	lock       sync.Mutex
+	restarting map[types.UID]time.Time
+	evicted    string
+	reason     string
+}
+
+func (c *Candidate) evictionEnabled() bool {
+	return c.EvictNotReadyAfter > 0 || c.EvictRestartingAfter > 0
+}
+
+// checkLeaderHealth deletes the Lease if the leader Pod has been unhealthy for too long.
+// It returns nil if the Lease was deleted, otherwise a result telling when to check again.
+func (c *Candidate) checkLeaderHealth(ctx context.Context, lease *coordination_v1.Lease) (*coordination_v1.Lease, ctrl.Result, error) {
+	leader, err := c.getPod(ctx, holderNamespace(lease, c.ElectionName.Namespace), holder(lease))
+	if err != nil || leader == nil {
+		return lease, ctrl.Result{}, err
+	}
+
+	reason, remaining := c.unhealthy(leader)
+	switch {
+	case reason == "":
+		return lease, ctrl.Result{}, nil
+	case remaining > 0:
+		c.Logger.Debugf("Leader %v of %v is %s, evicting in %v", leader.Name, c.ElectionName, reason, remaining)
+		return lease, ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	if tenure := c.tenureRemaining(lease); tenure > 0 {
+		c.Logger.Debugf("Leader %v of %v is %s, evicting after the minimum tenure, in %v", leader.Name, c.ElectionName, reason, tenure)
+		return lease, ctrl.Result{RequeueAfter: tenure}, nil
+	}
+
+	err = c.Backend.Release(ctx, lease)
+	switch {
+	case k8serrors.IsConflict(err) || k8serrors.IsNotFound(err):
+		// Someone else got there first, or the Lease changed hands
+		return lease, ctrl.Result{Requeue: true}, nil
+	case err != nil:
+		return nil, ctrl.Result{}, err
+	}
+
+	metrics.LeadersEvicted.WithLabelValues(reason).Inc()
+	c.Logger.Warnf("Evicted leader %v of %v, it was %s", leader.Name, c.ElectionName, reason)
+
+	c.health.lock.Lock()
+	c.health.evicted = leader.Name
+	c.health.reason = reason
+	c.health.lock.Unlock()
+
+	return nil, ctrl.Result{}, nil
+}
+
+// logSuccession logs the outcome of the first campaign after an eviction.
+func (c *Candidate) logSuccession(lease *coordination_v1.Lease) {
+	c.health.lock.Lock()
+	defer c.health.lock.Unlock()
+
+	if c.health.evicted == "" || lease == nil {
+		return
+	}
+	c.Logger.Infof("New leader of %v is %v, after evicting %v for being %s", c.ElectionName, holder(lease), c.health.evicted, c.health.reason)
+	c.health.evicted = ""
+	c.health.reason = ""
+}
+
+// unhealthy returns why the Pod should not be leader, if anything, and how long until it has been so for too long.
+func (c *Candidate) unhealthy(pod *core_v1.Pod) (string, time.Duration) {
+	now := c.Clock.Now()
+
+	if c.EvictNotReadyAfter > 0 {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == core_v1.PodReady && condition.Status != core_v1.ConditionTrue {
+				return EvictionReasonNotReady, condition.LastTransitionTime.Add(c.EvictNotReadyAfter).Sub(now)
+			}
+		}
+	}
+
+	if c.EvictRestartingAfter > 0 {
+		c.health.lock.Lock()
+		defer c.health.lock.Unlock()
+		if c.health.restarting == nil {
+			c.health.restarting = make(map[types.UID]time.Time)
+		}
+
+		if restarting(pod, c.EvictRestartingContainers) {
+			since, ok := c.health.restarting[pod.UID]
+			if !ok {
+				since = now
+				c.health.restarting[pod.UID] = since
+			}
+			return EvictionReasonRestarting, since.Add(c.EvictRestartingAfter).Sub(now)
+		}
+		delete(c.health.restarting, pod.UID)
+	}
+
+	return "", 0
+}
+
+// restarting reports whether any of the named containers, or any container if none are named,
+// has restarted and is not ready.
+func restarting(pod *core_v1.Pod, containers []string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if len(containers) > 0 && !slices.Contains(containers, status.Name) {
+			continue
+		}
+		if status.RestartCount > 0 && !status.Ready {
+			return true
+		}
+	}
+	return false
+}
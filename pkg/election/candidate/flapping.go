@@ -0,0 +1,126 @@
+package candidate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/nais/elector/pkg/metrics"
+)
+
+// transitionBreaker remembers when leadership changed hands, and freezes the election when it happens too often.
+// Each candidate only counts the transitions it has seen itself, so a candidate that starts while the election
+// is flapping won't freeze until it has seen enough of them, and candidates can freeze and thaw at slightly
+// different times.
+type transitionBreaker struct {
+	lock        sync.Mutex
+	epoch       int64
+	transitions []time.Time
+	frozen      bool
+}
+
+// tenureRemaining is how long until the holder of the Lease has served the minimum tenure.
+// Until then, the holder doesn't step down when asked to or when becoming ineligible, and isn't evicted.
+func (c *Candidate) tenureRemaining(lease *coordination_v1.Lease) time.Duration {
+	if c.MinTenure <= 0 || lease.Spec.AcquireTime == nil {
+		return 0
+	}
+	return lease.Spec.AcquireTime.Add(c.MinTenure).Sub(c.Clock.Now())
+}
+
+// observeTransition records a new leadership term, when the epoch changes. The term that is current
+// when we start isn't counted, as we didn't see it begin.
+func (c *Candidate) observeTransition(epoch int64) {
+	if c.TransitionLimit <= 0 || epoch == 0 {
+		return
+	}
+	b := &c.breaker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if epoch == b.epoch {
+		return
+	}
+	if b.epoch != 0 {
+		b.transitions = append(b.transitions, c.Clock.Now())
+	}
+	b.epoch = epoch
+}
+
+// frozen reports whether there have been more than TransitionLimit transitions within TransitionWindow,
+// and if so, when enough of them are outside the window for the election to thaw.
+func (c *Candidate) frozen() (time.Time, bool) {
+	if c.TransitionLimit <= 0 {
+		return time.Time{}, false
+	}
+	now := c.Clock.Now()
+	b := &c.breaker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	cutoff := now.Add(-c.TransitionWindow)
+	for len(b.transitions) > 0 && !b.transitions[0].After(cutoff) {
+		b.transitions = b.transitions[1:]
+	}
+	frozen := len(b.transitions) > c.TransitionLimit
+	until := time.Time{}
+	if frozen {
+		until = b.transitions[len(b.transitions)-c.TransitionLimit-1].Add(c.TransitionWindow)
+	}
+
+	if frozen != b.frozen {
+		b.frozen = frozen
+		if frozen {
+			metrics.ElectionsFrozen.WithLabelValues(c.ElectionName.String()).Set(1)
+			c.Logger.Warnf("Leadership of %v changed %d times in %v, freezing the election until %v", c.ElectionName, len(b.transitions), c.TransitionWindow, until)
+		} else {
+			metrics.ElectionsFrozen.WithLabelValues(c.ElectionName.String()).Set(0)
+			c.Logger.Infof("Election %v is no longer frozen", c.ElectionName)
+		}
+	}
+	return until, frozen
+}
+
+func (c *Candidate) isFrozen() bool {
+	c.breaker.lock.Lock()
+	defer c.breaker.lock.Unlock()
+	return c.breaker.frozen
+}
+
+// whileFrozen keeps leadership as it is. A leader in renewing mode still renews its Lease,
+// but nobody takes over, preempts, rebalances or evicts until the election thaws.
+func (c *Candidate) whileFrozen(ctx context.Context, lease *coordination_v1.Lease, until time.Time) (ctrl.Result, error) {
+	var err error
+
+	c.Logger.Debugf("Election %v is frozen until %v", c.ElectionName, until)
+	result := ctrl.Result{RequeueAfter: until.Sub(c.Clock.Now())}
+	if c.Mode == ModeRenewing && lease != nil && c.isHolder(lease) {
+		var renewal ctrl.Result
+		lease, renewal, err = c.maintainLease(ctx, lease)
+		if err != nil {
+			err = fmt.Errorf("error maintaining lease: %w", err)
+			c.Logger.Error(err)
+			return ctrl.Result{}, err
+		}
+		result = earliest(result, renewal)
+	}
+	c.updateElection(lease)
+	return result, nil
+}
+
+// leaderGone reports whether the election has no leader to keep while frozen, as there is no Lease,
+// or it has expired. Candidates campaign for it as usual, so the election isn't left without a leader.
+func (c *Candidate) leaderGone(lease *coordination_v1.Lease) bool {
+	if lease == nil {
+		return true
+	}
+	if c.Mode != ModeRenewing || c.isHolder(lease) {
+		return false
+	}
+	expiry, expires := leaseExpiry(lease)
+	return expires && !c.Clock.Now().Before(expiry)
+}
@@ -0,0 +1,77 @@
+package candidate
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Identity is who a candidate is. The name is the holder identity on the Lease, and the name of the candidate Pod.
+type Identity struct {
+	Name string
+	// UID is the UID of the candidate Pod, if known. When set, the Pod found by name must have this UID.
+	UID types.UID
+}
+
+// IdentitySource tells a candidate who it is.
+type IdentitySource interface {
+	Identity() (Identity, error)
+}
+
+// StaticIdentity is an identity given up front, such as with a command line flag.
+type StaticIdentity Identity
+
+func (s StaticIdentity) Identity() (Identity, error) {
+	if s.Name == "" {
+		return Identity{}, fmt.Errorf("identity is empty")
+	}
+	return Identity(s), nil
+}
+
+// DownwardAPIIdentity reads the Pod name and UID from the POD_NAME and POD_UID environment variables,
+// which are set from the downward API.
+type DownwardAPIIdentity struct{}
+
+func (DownwardAPIIdentity) Identity() (Identity, error) {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		return Identity{}, fmt.Errorf("POD_NAME is not set")
+	}
+	return Identity{Name: name, UID: types.UID(os.Getenv("POD_UID"))}, nil
+}
+
+// HostnameIdentity uses the hostname, which is the Pod name unless the Pod uses the host network or sets its own hostname.
+type HostnameIdentity struct{}
+
+func (HostnameIdentity) Identity() (Identity, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Identity{}, fmt.Errorf("unable to get hostname: %w", err)
+	}
+	return Identity{Name: hostname}, nil
+}
+
+// ProcessIdentity is the hostname and process ID, which tells apart candidates running locally on the same machine.
+type ProcessIdentity struct{}
+
+func (ProcessIdentity) Identity() (Identity, error) {
+	identity, err := HostnameIdentity{}.Identity()
+	if err != nil {
+		return Identity{}, err
+	}
+	identity.Name = fmt.Sprintf("%s-%d", identity.Name, os.Getpid())
+	return identity, nil
+}
+
+// identitySource returns the configured source of our identity, or the default for where we run.
+func (c *Candidate) identitySource() IdentitySource {
+	switch {
+	case c.IdentitySource != nil:
+		return c.IdentitySource
+	case c.Local:
+		return ProcessIdentity{}
+	default:
+		return HostnameIdentity{}
+	}
+}
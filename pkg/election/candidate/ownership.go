@@ -0,0 +1,86 @@
+package candidate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// AnnotationHolderNamespace records the namespace of the holder Pod on the Lease.
+	AnnotationHolderNamespace = "elector.nais.io/holder-namespace"
+	// AnnotationHolderUID records the UID of the holder Pod on the Lease.
+	AnnotationHolderUID = "elector.nais.io/holder-uid"
+
+	// orphanCheckInterval is how often followers check that a holder Pod in another namespace still exists,
+	// as we don't get events for Pods outside our cache.
+	orphanCheckInterval = 30 * time.Second
+)
+
+func (c *Candidate) podNamespace() string {
+	if c.PodNamespace != "" {
+		return c.PodNamespace
+	}
+	return c.ElectionName.Namespace
+}
+
+// setOwnership records our Pod as the owner of the Lease. Within a namespace, the OwnerReference makes the
+// garbage collector delete the Lease when the holder Pod is deleted. OwnerReferences can't cross
+// namespaces, so for those Leases the followers check for orphans instead.
+func (c *Candidate) setOwnership(lease *coordination_v1.Lease) {
+	if c.ownerReference == nil {
+		// Local candidates have no Pod to own the Lease
+		return
+	}
+	lease.Annotations[AnnotationHolderNamespace] = c.podNamespace()
+	lease.Annotations[AnnotationHolderUID] = string(c.ownerReference.UID)
+	if c.podNamespace() == c.ElectionName.Namespace {
+		lease.OwnerReferences = []meta_v1.OwnerReference{
+			*c.ownerReference,
+		}
+	} else {
+		lease.OwnerReferences = nil
+	}
+}
+
+// checkOrphaned deletes a Lease held by a Pod in another namespace, if that Pod is gone.
+// It returns nil if the Lease was deleted.
+func (c *Candidate) checkOrphaned(ctx context.Context, lease *coordination_v1.Lease) (*coordination_v1.Lease, ctrl.Result, error) {
+	namespace := holderNamespace(lease, c.ElectionName.Namespace)
+	if namespace == c.ElectionName.Namespace || c.isHolder(lease) {
+		return lease, ctrl.Result{}, nil
+	}
+
+	pod, err := c.getPod(ctx, namespace, holder(lease))
+	if err != nil {
+		return nil, ctrl.Result{}, fmt.Errorf("unable to get holder Pod: %w", err)
+	}
+	uid := lease.Annotations[AnnotationHolderUID]
+	if pod != nil && (uid == "" || uid == string(pod.UID)) {
+		return lease, ctrl.Result{RequeueAfter: orphanCheckInterval}, nil
+	}
+
+	err = c.Backend.Release(ctx, lease)
+	switch {
+	case k8serrors.IsConflict(err) || k8serrors.IsNotFound(err):
+		return lease, ctrl.Result{Requeue: true}, nil
+	case err != nil:
+		return nil, ctrl.Result{}, err
+	}
+	c.Logger.Infof("Deleted Lease %v, as holder Pod %s/%s is gone", c.ElectionName, namespace, holder(lease))
+	return nil, ctrl.Result{}, nil
+}
+
+// holderNamespace returns the namespace of the holder Pod. Leases without the annotation were created
+// by candidates in the election namespace.
+func holderNamespace(lease *coordination_v1.Lease, electionNamespace string) string {
+	if namespace := lease.Annotations[AnnotationHolderNamespace]; namespace != "" {
+		return namespace
+	}
+	return electionNamespace
+}
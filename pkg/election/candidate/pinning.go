@@ -0,0 +1,83 @@
+package candidate
+
+import (
+	"context"
+	"fmt"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	core_v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// AnnotationPinnedHolder names the Pod that must be leader. It can be set on the Lease,
+// or on the ConfigMap given by PinConfigMap. The Lease takes precedence.
+const AnnotationPinnedHolder = "elector.nais.io/pinned-holder"
+
+// pinnedHolder returns the Pod leadership is pinned to, or an empty string if it isn't pinned.
+func (c *Candidate) pinnedHolder(ctx context.Context, lease *coordination_v1.Lease) (string, error) {
+	if lease != nil {
+		if pinned := lease.Annotations[AnnotationPinnedHolder]; pinned != "" {
+			return pinned, nil
+		}
+	}
+	if c.PinConfigMap == "" {
+		return "", nil
+	}
+
+	configMap := &core_v1.ConfigMap{}
+	key := client.ObjectKey{
+		Namespace: c.ElectionName.Namespace,
+		Name:      c.PinConfigMap,
+	}
+	err := c.Get(ctx, key, configMap)
+	switch {
+	case k8serrors.IsNotFound(err):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("unable to get ConfigMap %v: %w", key, err)
+	}
+	return configMap.Annotations[AnnotationPinnedHolder], nil
+}
+
+// followPin makes the pinned Pod take over the Lease. Other candidates neither campaign, take over nor preempt
+// while leadership is pinned, but a pinned leader still renews its Lease.
+func (c *Candidate) followPin(ctx context.Context, lease *coordination_v1.Lease, pinned string) (ctrl.Result, error) {
+	var err error
+
+	if pinned == c.identity && (lease == nil || !c.isHolder(lease)) {
+		c.Logger.Infof("Leadership of %v is pinned to us, taking over", c.ElectionName)
+		if lease == nil {
+			lease, err = c.runCampaign(ctx)
+		} else {
+			lease, err = c.takeOverLease(ctx, lease)
+		}
+		if err != nil {
+			err = fmt.Errorf("error taking over pinned leadership: %w", err)
+			c.Logger.Error(err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	result := ctrl.Result{}
+	if c.Mode == ModeRenewing && lease != nil && c.isHolder(lease) {
+		lease, result, err = c.maintainLease(ctx, lease)
+		if err != nil {
+			err = fmt.Errorf("error maintaining lease: %w", err)
+			c.Logger.Error(err)
+			return ctrl.Result{}, err
+		}
+	}
+	c.updateElection(lease)
+	return result, nil
+}
+
+// mapConfigMap turns events for the pinning ConfigMap into a check of the election.
+func (c *Candidate) mapConfigMap(_ context.Context, configMap client.Object) []reconcile.Request {
+	if configMap.GetNamespace() != c.ElectionName.Namespace || configMap.GetName() != c.PinConfigMap {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: c.ElectionName}}
+}
@@ -0,0 +1,145 @@
+package candidate
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	core_v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/nais/elector/pkg/metrics"
+)
+
+const (
+	// AnnotationPriority overrides the configured priority when set on a candidate Pod,
+	// and records the priority of the holder when set on a Lease.
+	AnnotationPriority = "elector.nais.io/priority"
+	// AnnotationPreemptedBy is set on a Lease by a higher priority candidate asking the leader to step down.
+	AnnotationPreemptedBy = "elector.nais.io/preempted-by"
+
+	// MaxPriority is the highest priority a candidate can have.
+	MaxPriority = 10
+
+	// preemptionHoldoff is how long a leader that stepped down waits before campaigning again,
+	// giving the candidate that asked for it a chance to win.
+	preemptionHoldoff = 5 * time.Second
+)
+
+// campaignDelay is how long to wait before campaigning. Candidates wait PriorityBackoff for
+// each priority level below MaxPriority, so higher priority candidates get to campaign first.
+// Candidates outside the preferred topology wait some more, and then there is some jitter.
+func (c *Candidate) campaignDelay() time.Duration {
+	delay := c.PriorityBackoff*time.Duration(MaxPriority-c.Priority) + c.topologyDelay() + c.jitter()
+
+	c.campaignLock.Lock()
+	defer c.campaignLock.Unlock()
+	if holdoff := c.holdoffUntil.Sub(c.Clock.Now()); holdoff > delay {
+		delay = holdoff
+	}
+	return delay
+}
+
+// campaignWait returns how much longer to wait before campaigning. The wait starts when we first find the election
+// without a leader, so checks of the election in the meantime don't start it over.
+func (c *Candidate) campaignWait() time.Duration {
+	delay := c.campaignDelay()
+
+	c.campaignLock.Lock()
+	defer c.campaignLock.Unlock()
+	now := c.Clock.Now()
+	if c.campaignAt.IsZero() {
+		c.campaignAt = now.Add(delay)
+	}
+	if c.holdoffUntil.After(c.campaignAt) {
+		c.campaignAt = c.holdoffUntil
+	}
+	return c.campaignAt.Sub(now)
+}
+
+// endCampaignWait forgets the wait before campaigning, once the election has a leader again.
+func (c *Candidate) endCampaignWait() {
+	c.campaignLock.Lock()
+	defer c.campaignLock.Unlock()
+	c.campaignAt = time.Time{}
+}
+
+// checkPreemption steps down if another candidate has asked us to, and asks the leader to step down
+// if we are ready and have a higher priority, or should rebalance. It returns nil if we stepped down.
+func (c *Candidate) checkPreemption(ctx context.Context, lease *coordination_v1.Lease) (*coordination_v1.Lease, ctrl.Result, error) {
+	preemptor := lease.Annotations[AnnotationPreemptedBy]
+
+	if c.isHolder(lease) {
+		if preemptor == "" || preemptor == c.identity {
+			return lease, ctrl.Result{}, nil
+		}
+		if tenure := c.tenureRemaining(lease); tenure > 0 {
+			c.Logger.Infof("Preempted by %s, but stepping down as leader of %v only after the minimum tenure, in %v", preemptor, c.ElectionName, tenure)
+			return lease, ctrl.Result{RequeueAfter: tenure}, nil
+		}
+		return nil, ctrl.Result{}, c.stepDown(ctx, "preempted by "+preemptor)
+	}
+
+	if preemptor != "" || !c.shouldPreempt(lease) || c.holdsOtherSlot() {
+		return lease, ctrl.Result{}, nil
+	}
+	pod, err := c.getOwnPod(ctx)
+	if err != nil || pod == nil || !podReady(pod) {
+		return lease, ctrl.Result{}, err
+	}
+	return lease, ctrl.Result{}, c.requestPreemption(ctx, lease)
+}
+
+// stepDown deletes the Lease if we hold it, and holds off campaigning for a little while.
+func (c *Candidate) stepDown(ctx context.Context, reason string) error {
+	c.campaignLock.Lock()
+	defer c.campaignLock.Unlock()
+
+	c.Logger.Infof("Stepping down as leader of %v: %s", c.ElectionName, reason)
+	c.holdoffUntil = c.Clock.Now().Add(preemptionHoldoff)
+	_, err := c.deleteLease(ctx)
+	return err
+}
+
+func (c *Candidate) shouldPreempt(lease *coordination_v1.Lease) bool {
+	return (c.Preemption && c.Priority > leasePriority(lease)) || c.rebalance(lease)
+}
+
+func (c *Candidate) requestPreemption(ctx context.Context, lease *coordination_v1.Lease) error {
+	lease = lease.DeepCopy()
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[AnnotationPreemptedBy] = c.identity
+
+	err := c.Backend.Update(ctx, lease)
+	switch {
+	case k8serrors.IsConflict(err) || k8serrors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	metrics.PreemptionsRequested.WithLabelValues().Inc()
+	c.Logger.Infof("Asked %v to step down as leader of %v", holder(lease), c.ElectionName)
+	return nil
+}
+
+// leasePriority is the priority of the Lease holder. Leases without a priority are treated as the lowest priority.
+func leasePriority(lease *coordination_v1.Lease) int {
+	priority, err := strconv.Atoi(lease.Annotations[AnnotationPriority])
+	if err != nil {
+		return 0
+	}
+	return priority
+}
+
+func podReady(pod *core_v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core_v1.PodReady {
+			return condition.Status == core_v1.ConditionTrue
+		}
+	}
+	return false
+}
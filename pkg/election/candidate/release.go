@@ -0,0 +1,136 @@
+package candidate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// Release gives up leadership and stops the candidate from campaigning again.
+// If we were the leader, it waits up to SuccessorTimeout for another candidate to take over.
+func (c *Candidate) Release(ctx context.Context) error {
+	if c.Observer {
+		return nil
+	}
+	released, err := c.resign(ctx)
+	if err != nil {
+		return err
+	}
+	if !released || c.SuccessorTimeout <= 0 {
+		return nil
+	}
+
+	c.Logger.Infof("Waiting up to %v for a successor in election %v", c.SuccessorTimeout, c.ElectionName)
+	ctx, cancel := context.WithTimeout(ctx, c.SuccessorTimeout)
+	defer cancel()
+	err = c.awaitSuccessor(ctx)
+	if err != nil {
+		c.Logger.Warnf("No successor seen in election %v: %v", c.ElectionName, err)
+	}
+	return nil
+}
+
+// ReleaseAll releases leadership in all the given elections at the same time.
+func ReleaseAll(ctx context.Context, candidates []*Candidate) error {
+	errs := make([]error, len(candidates))
+	wg := sync.WaitGroup{}
+	for i, c := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.Release(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// PreStopHandler releases leadership in all the given elections, and is intended to be called from a preStop hook.
+func PreStopHandler(logger logrus.FieldLogger, candidates []*Candidate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := ReleaseAll(r.Context(), candidates)
+		if err != nil {
+			err = fmt.Errorf("failed to release leadership: %w", err)
+			logger.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// resign deletes the Lease if we hold it, and reports whether we did.
+func (c *Candidate) resign(ctx context.Context) (bool, error) {
+	c.campaignLock.Lock()
+	defer c.campaignLock.Unlock()
+
+	if !c.resigned.Swap(true) {
+		c.Logger.Infof("Resigning from election %v", c.ElectionName)
+	}
+
+	return c.deleteLease(ctx)
+}
+
+// deleteLease deletes the Lease if we hold it, and reports whether we did.
+// The delete is conditional on the UID and resourceVersion we read, so a Lease that has changed hands is left alone.
+func (c *Candidate) deleteLease(ctx context.Context) (bool, error) {
+	released := false
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		lease, err := c.getLease(ctx)
+		if err != nil {
+			return err
+		}
+		if lease == nil || !c.isHolder(lease) {
+			return nil
+		}
+		err = c.Backend.Release(ctx, lease)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		released = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to delete Lease %v: %w", c.ElectionName, err)
+	}
+	if released {
+		c.Logger.Infof("Released Lease %v", c.ElectionName)
+	}
+	return released, nil
+}
+
+func (c *Candidate) awaitSuccessor(ctx context.Context) error {
+	return wait.PollUntilContextCancel(ctx, 250*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		lease, err := c.getLease(ctx)
+		if err != nil {
+			c.Logger.Debugf("Unable to check for successor: %v", err)
+			return false, nil
+		}
+		if lease == nil || c.isHolder(lease) {
+			return false, nil
+		}
+		c.Logger.Infof("Successor in election %v is %v", c.ElectionName, holder(lease))
+		return true, nil
+	})
+}
+
+// podTerminating reports whether our Pod is gone or about to go.
+func (c *Candidate) podTerminating(ctx context.Context) (bool, error) {
+	pod, err := c.getOwnPod(ctx)
+	switch {
+	case err != nil:
+		return false, err
+	case pod == nil:
+		return true, nil
+	default:
+		return pod.DeletionTimestamp != nil, nil
+	}
+}
@@ -0,0 +1,191 @@
+package candidate
+
+import (
+	"context"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/nais/elector/pkg/metrics"
+)
+
+// maintainLease renews the Lease if we hold it, or takes it over if it has expired.
+// The returned result tells the caller when the Lease needs to be looked at again.
+func (c *Candidate) maintainLease(ctx context.Context, lease *coordination_v1.Lease) (*coordination_v1.Lease, ctrl.Result, error) {
+	now := c.Clock.Now()
+
+	if c.isHolder(lease) {
+		renewed := lastRenewal(lease)
+		if next := renewed.Add(c.RenewInterval); now.Before(next) {
+			return lease, ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+		}
+		lease, err := c.renewLease(ctx, lease)
+		if err != nil {
+			return nil, ctrl.Result{}, err
+		}
+		return lease, ctrl.Result{RequeueAfter: c.RenewInterval}, nil
+	}
+
+	expiry, expires := leaseExpiry(lease)
+	if !expires {
+		return lease, ctrl.Result{}, nil
+	}
+	if now.Before(expiry) {
+		return lease, ctrl.Result{RequeueAfter: expiry.Sub(now) + c.jitter()}, nil
+	}
+
+	c.Logger.Infof("Lease %v held by %v expired at %v, attempting takeover", c.ElectionName, holder(lease), expiry)
+	lease, err := c.takeOverLease(ctx, lease)
+	if err != nil {
+		return nil, ctrl.Result{}, err
+	}
+	return lease, ctrl.Result{Requeue: true}, nil
+}
+
+// observeRenewal remembers when we last renewed the Lease, if we hold it in renewing mode.
+func (c *Candidate) observeRenewal(lease *coordination_v1.Lease) {
+	if c.Mode != ModeRenewing || lease == nil || !c.isHolder(lease) {
+		c.renewedAt.Store(0)
+		return
+	}
+	c.renewedAt.Store(lastRenewal(lease).UnixNano())
+}
+
+// checkRenewDeadline handles a failed check of the election while we hold the Lease in renewing mode. Until the Lease
+// would expire, we keep leading and check again in time to renew it. After that, another candidate may have taken over,
+// so we stop reporting ourselves as leader.
+func (c *Candidate) checkRenewDeadline(err error) (ctrl.Result, error) {
+	renewed := c.renewedAt.Load()
+	if renewed == 0 {
+		return ctrl.Result{}, err
+	}
+	deadline := time.Unix(0, renewed).Add(c.LeaseDuration)
+	now := c.Clock.Now()
+	if now.Before(deadline) {
+		c.Logger.Warnf("Unable to check Lease %v, still leader until %v: %v", c.ElectionName, deadline, err)
+		return ctrl.Result{RequeueAfter: min(c.RenewInterval, deadline.Sub(now))}, nil
+	}
+	c.Logger.Errorf("Unable to renew Lease %v since %v, no longer leader", c.ElectionName, time.Unix(0, renewed))
+	c.updateElection(nil)
+	return ctrl.Result{}, err
+}
+
+func (c *Candidate) renewLease(ctx context.Context, lease *coordination_v1.Lease) (*coordination_v1.Lease, error) {
+	now := meta_v1.NewMicroTime(c.Clock.Now())
+	lease = lease.DeepCopy()
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseDurationSeconds = c.leaseDurationSeconds()
+
+	err := c.Backend.Update(ctx, lease)
+	if err != nil {
+		if k8serrors.IsConflict(err) || k8serrors.IsNotFound(err) {
+			c.Logger.Infof("Lease %v changed while renewing, checking holder", c.ElectionName)
+			return c.getLease(ctx)
+		}
+		return nil, err
+	}
+	c.Logger.Debugf("Renewed Lease %v", c.ElectionName)
+	return lease, nil
+}
+
+// takeOverLease claims a Lease that has expired, or is pinned to us. The update carries the resourceVersion we read, so only one
+// of several competing candidates can succeed.
+func (c *Candidate) takeOverLease(ctx context.Context, lease *coordination_v1.Lease) (*coordination_v1.Lease, error) {
+	c.campaignLock.Lock()
+	defer c.campaignLock.Unlock()
+
+	if c.resigned.Load() {
+		return lease, nil
+	}
+	if c.slots != nil {
+		c.slots.lock.Lock()
+		defer c.slots.lock.Unlock()
+		if c.slots.holdsOther(c.slot) {
+			return lease, nil
+		}
+	}
+
+	lease = lease.DeepCopy()
+	transitions := int32(1)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions + 1
+	}
+
+	metrics.CampaignAttempts.WithLabelValues(metrics.CampaignTakeover).Inc()
+	err := c.claimLease(ctx, lease)
+	if err == nil {
+		lease.Spec.LeaseTransitions = &transitions
+		err = c.Backend.Update(ctx, lease)
+	}
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			// Released while we tried to take it over, so nobody won, and we campaign for it on the next check
+			c.Logger.Infof("Lease %v was deleted before it could be taken over", c.ElectionName)
+			return c.getLease(ctx)
+		}
+		if k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err) {
+			metrics.CampaignConflicts.WithLabelValues(metrics.CampaignTakeover).Inc()
+			metrics.ElectionsLost.WithLabelValues().Inc()
+			c.Logger.Infof("Lost election %v", c.ElectionName)
+			return c.getLease(ctx)
+		}
+		return nil, err
+	}
+	metrics.ElectionsWon.WithLabelValues().Inc()
+	c.Logger.Infof("Won election %v by taking over Lease", c.ElectionName)
+	if c.slots != nil {
+		c.slots.held[c.slot] = true
+	}
+	return lease, nil
+}
+
+// isHolder reports whether our Pod holds the Lease. Pods in different namespaces can have the same name,
+// and a Pod can be replaced by one with the same name, so the namespace and UID of the holder must match too.
+func (c *Candidate) isHolder(lease *coordination_v1.Lease) bool {
+	if c.identity == "" || holder(lease) != c.identity {
+		return false
+	}
+	if c.ownerReference == nil {
+		// Local candidates have no Pod, and record neither
+		return true
+	}
+	uid := lease.Annotations[AnnotationHolderUID]
+	return holderNamespace(lease, c.ElectionName.Namespace) == c.podNamespace() &&
+		(uid == "" || uid == string(c.ownerReference.UID))
+}
+
+func (c *Candidate) leaseDurationSeconds() *int32 {
+	seconds := int32(c.LeaseDuration.Seconds())
+	return &seconds
+}
+
+func holder(lease *coordination_v1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+// lastRenewal returns the last time the holder showed signs of life.
+func lastRenewal(lease *coordination_v1.Lease) time.Time {
+	switch {
+	case lease.Spec.RenewTime != nil:
+		return lease.Spec.RenewTime.Time
+	case lease.Spec.AcquireTime != nil:
+		return lease.Spec.AcquireTime.Time
+	}
+	return time.Time{}
+}
+
+// leaseExpiry returns when the Lease expires. Leases without a duration, such as those
+// created in owner-reference mode, never expire.
+func leaseExpiry(lease *coordination_v1.Lease) (time.Time, bool) {
+	if lease.Spec.LeaseDurationSeconds == nil {
+		return time.Time{}, false
+	}
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return lastRenewal(lease).Add(duration), true
+}
@@ -0,0 +1,171 @@
+package candidate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/nais/elector/pkg/election"
+	"github.com/nais/elector/pkg/logging"
+)
+
+// slotGroup makes sure a Pod holds at most one slot in an election with several leaders.
+type slotGroup struct {
+	lock sync.Mutex
+	held map[int]bool
+	// candidates for the other slots skip vacant slots while we hold one, so they are checked again when we let go
+	candidates []*Candidate
+}
+
+// holdsOther reports whether we hold any slot except the given one. The caller must hold the lock.
+func (g *slotGroup) holdsOther(slot int) bool {
+	for s, held := range g.held {
+		if held && s != slot {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Candidate) holdsOtherSlot() bool {
+	if c.slots == nil {
+		return false
+	}
+	c.slots.lock.Lock()
+	defer c.slots.lock.Unlock()
+	return c.slots.holdsOther(c.slot)
+}
+
+func (g *slotGroup) setHeld(slot int, held bool) {
+	g.lock.Lock()
+	released := g.held[slot] && !held
+	g.held[slot] = held
+	g.lock.Unlock()
+
+	if released {
+		for _, c := range g.candidates {
+			if c.slot != slot {
+				c.recheck()
+			}
+		}
+	}
+}
+
+type slotResult struct {
+	slot   int
+	result election.Result
+}
+
+// semaphore combines the results from the candidates for each slot into a single result.
+type semaphore struct {
+	Logger          logrus.FieldLogger
+	ElectionResults chan<- election.Result
+	ElectionName    types.NamespacedName
+
+	candidates []*Candidate
+	slots      []chan election.Result
+}
+
+// AddSemaphoreToManager adds an election where up to leaders candidates can lead at the same time.
+// Each slot is a separate Lease, named after the election and the slot number.
+func AddSemaphoreToManager(mgr ctrl.Manager, logger logrus.FieldLogger, electionResults chan<- election.Result, electionName types.NamespacedName, leaders int, config Config) ([]*Candidate, error) {
+	s := &semaphore{
+		Logger:          logger.WithField(logging.FieldComponent, "Semaphore"),
+		ElectionResults: electionResults,
+		ElectionName:    electionName,
+	}
+	group := &slotGroup{
+		held: make(map[int]bool, leaders),
+	}
+
+	for slot := 0; slot < leaders; slot++ {
+		slotName := types.NamespacedName{
+			Namespace: electionName.Namespace,
+			Name:      fmt.Sprintf("%s-%d", electionName.Name, slot),
+		}
+		slotResults := make(chan election.Result)
+		c, err := AddCandidateToManager(mgr, logger.WithField("slot", slot), slotResults, slotName, config)
+		if err != nil {
+			return nil, err
+		}
+		c.slot = slot
+		c.slots = group
+		s.candidates = append(s.candidates, c)
+		s.slots = append(s.slots, slotResults)
+	}
+	group.candidates = s.candidates
+
+	err := mgr.Add(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add semaphore runnable to controller-runtime manager: %w", err)
+	}
+
+	return s.candidates, nil
+}
+
+func (s *semaphore) Start(ctx context.Context) error {
+	updates := make(chan slotResult)
+	for slot, results := range s.slots {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case result := <-results:
+					select {
+					case <-ctx.Done():
+						return
+					case updates <- slotResult{slot: slot, result: result}:
+					}
+				}
+			}
+		}()
+	}
+
+	latest := make([]election.Result, len(s.slots))
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case update := <-updates:
+			latest[update.slot] = update.result
+			result := s.combine(latest)
+			s.Logger.Debugf("Sending election results for %v, holders are: %v", s.ElectionName, result.Holders)
+			s.ElectionResults <- result
+		}
+	}
+}
+
+// combine builds a single result from the latest result of each slot. If we hold a slot, we are
+// reported as leader with the epoch of our slot. Otherwise, the leader of the lowest slot is reported.
+func (s *semaphore) combine(latest []election.Result) election.Result {
+	combined := election.Result{
+		Holders: make([]string, len(latest)),
+	}
+	for slot, result := range latest {
+		combined.Holders[slot] = result.Leader
+		if result.Identity != "" {
+			combined.Identity = result.Identity
+		}
+		combined.Pinned = combined.Pinned || result.Pinned
+		combined.Frozen = combined.Frozen || result.Frozen
+		if result.Leader == "" {
+			continue
+		}
+		if result.Identity != "" && result.Leader == result.Identity {
+			combined.Leader = result.Leader
+			combined.Epoch = result.Epoch
+			combined.Slot = &slot
+			continue
+		}
+		if combined.Slot == nil && combined.Leader == "" {
+			combined.Leader = result.Leader
+			combined.Epoch = result.Epoch
+		}
+	}
+	return combined
+}
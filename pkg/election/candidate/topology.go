@@ -0,0 +1,70 @@
+package candidate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	coordination_v1 "k8s.io/api/coordination/v1"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationPreferred records on the Lease whether the holder runs in the preferred topology.
+const AnnotationPreferred = "elector.nais.io/preferred"
+
+// inPreferredTopology reports whether the Pod runs on a Node matching PreferredTopology, such as a zone or a node pool.
+// Without a preference, every Pod is preferred.
+func (c *Candidate) inPreferredTopology(ctx context.Context, pod *core_v1.Pod) (bool, error) {
+	if c.PreferredTopology == nil {
+		return true, nil
+	}
+	if pod.Spec.NodeName == "" {
+		return false, nil
+	}
+
+	// Nodes aren't in the cache, and we only need to look once
+	var reader client.Reader = c.Client
+	if c.APIReader != nil {
+		reader = c.APIReader
+	}
+	node := &core_v1.Node{}
+	err := reader.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, node)
+	if err != nil {
+		return false, fmt.Errorf("unable to get Node %s: %w", pod.Spec.NodeName, err)
+	}
+	return c.PreferredTopology.Matches(labels.Set(node.Labels)), nil
+}
+
+// topologyDelay is how long to wait before campaigning, to give candidates in the preferred topology a head start.
+func (c *Candidate) topologyDelay() time.Duration {
+	if c.PreferredTopology == nil || c.preferred {
+		return 0
+	}
+	return c.TopologyBackoff
+}
+
+// rebalance reports whether we should ask the leader to step down, as we are in the preferred topology and it isn't.
+// With preemption, a leader with a higher priority is left alone, as it would only preempt us right back.
+func (c *Candidate) rebalance(lease *coordination_v1.Lease) bool {
+	if c.Preemption && c.Priority < leasePriority(lease) {
+		return false
+	}
+	return c.Rebalance && c.PreferredTopology != nil && c.preferred && !leasePreferred(lease)
+}
+
+func (c *Candidate) setPreferred(lease *coordination_v1.Lease) {
+	if c.PreferredTopology == nil {
+		delete(lease.Annotations, AnnotationPreferred)
+		return
+	}
+	lease.Annotations[AnnotationPreferred] = strconv.FormatBool(c.preferred)
+}
+
+// leasePreferred reports whether the holder runs in the preferred topology. Leases without the annotation are
+// treated as preferred, so that they aren't rebalanced just for being written by an older version of elector.
+func leasePreferred(lease *coordination_v1.Lease) bool {
+	return lease.Annotations[AnnotationPreferred] != "false"
+}
@@ -0,0 +1,19 @@
+package election
+
+// Result is the outcome of an election, as sent from a candidate to the official.
+type Result struct {
+	// Leader is the identity of the current leader, or empty if there is none.
+	Leader string
+	// Identity is who the candidate that sent the result is, or empty for observers.
+	Identity string
+	// Epoch increases every time leadership changes hands, and can be used as a fencing token.
+	Epoch int64
+	// Pinned is set when an operator has pinned leadership to a specific Pod.
+	Pinned bool
+	// Frozen is set when leadership has changed hands too often recently, and the election is frozen as it is.
+	Frozen bool
+	// Slot is the slot we hold in an election with several leaders, or nil if we hold none.
+	Slot *int
+	// Holders lists the leader of each slot in an election with several leaders. Vacant slots are empty.
+	Holders []string
+}
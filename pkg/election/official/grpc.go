@@ -0,0 +1,114 @@
+package official
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	electorv1 "github.com/nais/elector/pkg/api/elector/v1"
+)
+
+// electionService serves the results of the elections over gRPC.
+type electionService struct {
+	electorv1.UnimplementedElectionServiceServer
+	server *server
+}
+
+// grpcServer creates a gRPC server with the election service, the health service and reflection.
+// Both the overall health and that of the election service follow readiness: serving once every election has a leader.
+func (s *server) grpcServer() *grpc.Server {
+	grpcServer := grpc.NewServer()
+	electorv1.RegisterElectionServiceServer(grpcServer, &electionService{server: s})
+
+	s.health = health.NewServer()
+	s.updateHealth()
+	healthpb.RegisterHealthServer(grpcServer, s.health)
+	reflection.Register(grpcServer)
+	return grpcServer
+}
+
+func (s *server) updateHealth() {
+	if s.health == nil {
+		return
+	}
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	serving := healthpb.HealthCheckResponse_SERVING
+	for _, o := range s.officials {
+		if o.readyz(nil) != nil {
+			serving = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	s.health.SetServingStatus("", serving)
+	s.health.SetServingStatus(electorv1.ElectionService_ServiceDesc.ServiceName, serving)
+}
+
+func (e *electionService) GetLeader(_ context.Context, request *electorv1.GetLeaderRequest) (*electorv1.Result, error) {
+	o, err := e.official(request.GetElection())
+	if err != nil {
+		return nil, err
+	}
+	return o.current().proto(), nil
+}
+
+func (e *electionService) WatchLeader(request *electorv1.WatchLeaderRequest, stream grpc.ServerStreamingServer[electorv1.Result]) error {
+	o, err := e.official(request.GetElection())
+	if err != nil {
+		return err
+	}
+
+	current, updates, stop, err := o.watch()
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer stop()
+
+	err = stream.Send(current.proto())
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case r := <-updates:
+			err = stream.Send(r.proto())
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// official finds the official for the named election, or the first election if no name is given.
+func (e *electionService) official(name string) (*official, error) {
+	if name == "" {
+		name = e.server.names[0]
+	}
+	o, ok := e.server.officials[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no election named %q", name)
+	}
+	return o, nil
+}
+
+func (r result) proto() *electorv1.Result {
+	p := &electorv1.Result{
+		Name:       r.Name,
+		LastUpdate: r.LastUpdate,
+		Epoch:      r.Epoch,
+		Holders:    r.Holders,
+		Pinned:     r.Pinned,
+		Frozen:     r.Frozen,
+	}
+	if r.Slot != nil {
+		slot := int32(*r.Slot)
+		p.Slot = &slot
+	}
+	return p
+}
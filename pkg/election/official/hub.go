@@ -0,0 +1,61 @@
+package official
+
+import (
+	"errors"
+	"sync"
+)
+
+// errTooManySubscribers is returned when an election already has as many subscribers as it accepts.
+var errTooManySubscribers = errors.New("too many subscribers, try again later")
+
+// hub broadcasts results to subscribers without ever waiting for them. Each subscriber has room for one result,
+// and a subscriber that falls behind has the result it hasn't picked up yet replaced by the latest one.
+type hub struct {
+	// max is the most subscribers the hub accepts at once, or zero for no limit
+	max int
+
+	lock        sync.Mutex
+	subscribers map[chan result]struct{}
+}
+
+// subscribe returns a channel that receives results as they are published, and a function to unsubscribe.
+// The channel is never closed, so it is safe to stop receiving from it at any time.
+func (h *hub) subscribe() (<-chan result, func(), error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.max > 0 && len(h.subscribers) >= h.max {
+		return nil, nil, errTooManySubscribers
+	}
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan result]struct{})
+	}
+	ch := make(chan result, 1)
+	h.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		delete(h.subscribers, ch)
+	}, nil
+}
+
+// publish sends the result to every subscriber.
+func (h *hub) publish(r result) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for ch := range h.subscribers {
+		// Replace a result the subscriber hasn't picked up yet. Only publish sends, so there is room afterwards.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- r
+	}
+}
+
+// len returns the number of subscribers.
+func (h *hub) len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.subscribers)
+}
@@ -0,0 +1,205 @@
+package official
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/benjamintf1/unmarshalledmatchers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"github.com/nais/elector/pkg/election"
+)
+
+var _ = Describe("Hub", func() {
+	var h *hub
+
+	BeforeEach(func() {
+		h = &hub{}
+	})
+
+	It("should broadcast results to every subscriber", func() {
+		first, stopFirst, err := h.subscribe()
+		Expect(err).ToNot(HaveOccurred())
+		second, _, err := h.subscribe()
+		Expect(err).ToNot(HaveOccurred())
+
+		h.publish(result{Name: "leader"})
+		Expect(first).To(Receive(Equal(result{Name: "leader"})))
+		Expect(second).To(Receive(Equal(result{Name: "leader"})))
+
+		stopFirst()
+		stopFirst()
+		h.publish(result{Name: "next leader"})
+		Expect(first).ToNot(Receive())
+		Expect(second).To(Receive(Equal(result{Name: "next leader"})))
+		Expect(h.len()).To(Equal(1))
+	})
+
+	It("should only keep the latest result for subscribers that fall behind", func() {
+		updates, _, err := h.subscribe()
+		Expect(err).ToNot(HaveOccurred())
+
+		for epoch := range int64(100) {
+			h.publish(result{Epoch: epoch})
+		}
+		Expect(updates).To(Receive(Equal(result{Epoch: 99})))
+		Expect(updates).ToNot(Receive())
+	})
+
+	It("should limit the number of subscribers", func() {
+		h.max = 2
+		_, stop, err := h.subscribe()
+		Expect(err).ToNot(HaveOccurred())
+		_, _, err = h.subscribe()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = h.subscribe()
+		Expect(err).To(MatchError(errTooManySubscribers))
+
+		stop()
+		_, _, err = h.subscribe()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("with sse clients", func() {
+		const clients = 2000
+
+		var o *official
+		var electionResults chan election.Result
+		var url string
+		var client *http.Client
+
+		BeforeEach(func() {
+			electionResults = make(chan election.Result)
+			o = &official{
+				Logger:          logrus.New(),
+				ElectionResults: electionResults,
+				lastResult:      result{Name: "first leader", Epoch: 1},
+			}
+		})
+
+		JustBeforeEach(func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			s := &server{
+				Logger:    o.Logger,
+				names:     []string{"first"},
+				officials: map[string]*official{"first": o},
+			}
+			go func() {
+				_ = o.run(ctx)
+			}()
+
+			httpServer := httptest.NewServer(s.mux(ctx))
+			url = httpServer.URL + "/sse"
+			client = &http.Client{Transport: &http.Transport{}}
+			DeferCleanup(func() {
+				// Streams only end when the server is done or the client goes away
+				cancel()
+				client.CloseIdleConnections()
+				httpServer.Close()
+			})
+		})
+
+		connect := func() (*http.Response, *bufio.Reader) {
+			res, err := client.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+			return res, bufio.NewReader(res.Body)
+		}
+
+		event := func(reader *bufio.Reader) string {
+			line, err := reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			Expect(line).To(HavePrefix("data: "))
+			Expect(reader.ReadString('\n')).To(Equal("\n"))
+			return strings.TrimPrefix(line, "data: ")
+		}
+
+		// everyone runs f for each client at once
+		everyone := func(f func(i int)) {
+			var wg sync.WaitGroup
+			for i := range clients {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					f(i)
+				}()
+			}
+			wg.Wait()
+		}
+
+		It("should stream to thousands of clients, and forget them when they go away", func() {
+			responses := make([]*http.Response, clients)
+			readers := make([]*bufio.Reader, clients)
+			everyone(func(i int) {
+				responses[i], readers[i] = connect()
+				Expect(event(readers[i])).To(ContainUnorderedJSON(`{"name":"first leader","epoch":1}`))
+			})
+			Expect(o.hub.len()).To(Equal(clients))
+
+			electionResults <- election.Result{Leader: "second leader", Epoch: 2}
+			everyone(func(i int) {
+				Expect(event(readers[i])).To(ContainUnorderedJSON(`{"name":"second leader","epoch":2}`))
+			})
+
+			everyone(func(i int) {
+				Expect(responses[i].Body.Close()).To(Succeed())
+			})
+			Eventually(o.hub.len).Should(BeZero())
+		})
+
+		It("should not wait for clients that don't read", func() {
+			stalled, _ := connect()
+			defer stalled.Body.Close()
+			_, reader := connect()
+			Expect(event(reader)).To(ContainUnorderedJSON(`{"name":"first leader"}`))
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for epoch := range int64(10000) {
+					electionResults <- election.Result{Leader: strings.Repeat("x", 1000), Epoch: epoch + 2}
+				}
+				electionResults <- election.Result{Leader: "last leader", Epoch: 10002}
+			}()
+			Eventually(done).WithTimeout(10 * time.Second).Should(BeClosed())
+
+			// The reading client catches up with the latest result, skipping the ones it was too slow for
+			data := event(reader)
+			for !strings.Contains(data, "last leader") {
+				data = event(reader)
+			}
+			Expect(data).To(ContainUnorderedJSON(`{"name":"last leader","epoch":10002}`))
+		})
+
+		Context("with a limit of one client", func() {
+			BeforeEach(func() {
+				o.hub.max = 1
+			})
+
+			It("should reject clients over the limit until others go away", func() {
+				first, reader := connect()
+				Expect(event(reader)).To(ContainUnorderedJSON(`{"name":"first leader"}`))
+
+				res, err := client.Get(url)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res.StatusCode).To(Equal(http.StatusServiceUnavailable))
+				Expect(res.Body.Close()).To(Succeed())
+
+				Expect(first.Body.Close()).To(Succeed())
+				Eventually(o.hub.len).Should(BeZero())
+				second, reader := connect()
+				defer second.Body.Close()
+				Expect(event(reader)).To(ContainUnorderedJSON(`{"name":"first leader"}`))
+			})
+		})
+	})
+})
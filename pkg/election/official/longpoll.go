@@ -0,0 +1,71 @@
+package official
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxWait is the longest a client can wait for leadership to change in a single request.
+const maxWait = 5 * time.Minute
+
+// etag identifies everything in the result except when it was last updated, so that it changes when leadership
+// changes hands, but also when the holders of other slots change, or the election is pinned or frozen.
+func (r result) etag() string {
+	r.LastUpdate = ""
+	// A result has nothing that can fail to marshal
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches checks if the etag is in the list of an If-None-Match header. Weak tags match their strong counterparts.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// waitParameter returns how long the request asks to wait for leadership to change, which is zero for requests that don't.
+func waitParameter(r *http.Request) (time.Duration, error) {
+	text := r.URL.Query().Get("wait")
+	if text == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(text)
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("wait should be a positive duration like 30s, got %q", text)
+	}
+	return min(wait, maxWait), nil
+}
+
+// waitForChange waits until the result no longer matches the If-None-Match header, the wait is over or the request
+// is cancelled, and returns the current result.
+func (o *official) waitForChange(ctx context.Context, match string, wait time.Duration) (result, error) {
+	current, updates, stop, err := o.watch()
+	if err != nil {
+		return current, err
+	}
+	defer stop()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for etagMatches(match, current.etag()) {
+		select {
+		case <-ctx.Done():
+			return current, nil
+		case <-timeout.C:
+			return current, nil
+		case current = <-updates:
+		}
+	}
+	return current, nil
+}
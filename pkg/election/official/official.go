@@ -4,48 +4,137 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/nais/elector/pkg/election"
 	"github.com/nais/elector/pkg/logging"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sync"
 	"time"
 )
 
 type official struct {
 	Logger          logrus.FieldLogger
-	ElectionResults <-chan string
-	ElectionAddress string
+	ElectionResults <-chan election.Result
 	lastResult      result
-	sseSubscribers  []chan<- result
+
+	// lock guards lastResult, which is updated by run and read by the handlers
+	lock sync.RWMutex
+	// hub broadcasts every new result to the handlers that stream results
+	hub hub
+	// updated is called after every new result
+	updated func()
 }
 
 type result struct {
-	Name       string `json:"name,omitempty"`
-	LastUpdate string `json:"last_update,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	LastUpdate string   `json:"last_update,omitempty"`
+	Epoch      int64    `json:"epoch,omitempty"`
+	Slot       *int     `json:"slot,omitempty"`
+	Holders    []string `json:"holders,omitempty"`
+	Pinned     bool     `json:"pinned,omitempty"`
+	Frozen     bool     `json:"frozen,omitempty"`
+
+	// identity is who we are, which is only shown on /role
+	identity string
+}
+
+// role tells a candidate if it is the leader.
+type role struct {
+	IsLeader bool   `json:"is_leader"`
+	Identity string `json:"identity"`
+	Leader   string `json:"leader"`
 }
 
 func (o *official) readyz(_ *http.Request) error {
-	if o.lastResult.Name == "" {
+	if o.current().Name == "" {
 		return fmt.Errorf("no election has run")
 	}
 	return nil
 }
 
-func (o *official) leaderHandler(w http.ResponseWriter, _ *http.Request) {
-	bytes, done := o.marshalResult(w, o.lastResult)
+func (o *official) current() result {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return o.lastResult
+}
+
+// watch returns the current result, a channel that receives the latest result whenever it changes, and a function
+// to stop watching. A watcher that falls behind only gets the latest result. No update is missed or repeated
+// between the current result and the first one on the channel.
+func (o *official) watch() (result, <-chan result, func(), error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	updates, stop, err := o.hub.subscribe()
+	return o.lastResult, updates, stop, err
+}
+
+// leaderHandler responds with the current result. Clients that send the ETag back in If-None-Match get 304 Not Modified
+// until the result changes, and can ask to wait for the change with the wait query parameter.
+func (o *official) leaderHandler(w http.ResponseWriter, r *http.Request) {
+	wait, err := waitParameter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current := o.current()
+	match := r.Header.Get("If-None-Match")
+	if match != "" && wait > 0 && etagMatches(match, current.etag()) {
+		current, err = o.waitForChange(r.Context(), match, wait)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", current.etag())
+	if match != "" && etagMatches(match, current.etag()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	bytes, done := o.marshalResult(w, current)
 	if done {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache")
-	_, err := w.Write(bytes)
+	_, err = w.Write(bytes)
 	if err != nil {
 		o.Logger.Errorf("failed to write response: %v", err)
 		return
 	}
 }
 
+// roleHandler responds with our role in the election, with 200 OK for the leader and 503 Service Unavailable for
+// followers, observers, and before the first election, so it can be used directly as an HTTP probe.
+func (o *official) roleHandler(w http.ResponseWriter, _ *http.Request) {
+	current := o.current()
+	r := role{
+		IsLeader: current.identity != "" && current.Name == current.identity,
+		Identity: current.identity,
+		Leader:   current.Name,
+	}
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		o.Logger.Errorf("failed to marshal JSON response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if !r.IsLeader {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, err = w.Write(bytes)
+	if err != nil {
+		o.Logger.Errorf("failed to write response: %v", err)
+	}
+}
+
 func (o *official) marshalResult(w http.ResponseWriter, lastResult result) ([]byte, bool) {
 	bytes, err := json.Marshal(lastResult)
 	if err != nil {
@@ -56,17 +145,20 @@ func (o *official) marshalResult(w http.ResponseWriter, lastResult result) ([]by
 	return bytes, false
 }
 
-func (o *official) sseHandler(ctx context.Context) func(w http.ResponseWriter, _ *http.Request) {
-	return func(w http.ResponseWriter, _ *http.Request) {
+func (o *official) sseHandler(ctx context.Context) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current, updates, stop, err := o.watch()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer stop()
+
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
-		ch := make(chan result)
-		defer close(ch)
-		o.sseSubscribers = append(o.sseSubscribers, ch)
-
-		bytes, done := o.marshalResult(w, o.lastResult)
+		bytes, done := o.marshalResult(w, current)
 		if done {
 			return
 		}
@@ -78,8 +170,11 @@ func (o *official) sseHandler(ctx context.Context) func(w http.ResponseWriter, _
 			select {
 			case <-ctx.Done():
 				return
-			case r := <-ch:
-				bytes, done = o.marshalResult(w, r)
+			case <-r.Context().Done():
+				// The client has gone away
+				return
+			case update := <-updates:
+				bytes, done = o.marshalResult(w, update)
 				if done {
 					return
 				}
@@ -90,54 +185,75 @@ func (o *official) sseHandler(ctx context.Context) func(w http.ResponseWriter, _
 	}
 }
 
-func (o *official) Start(ctx context.Context) error {
-	ctx, cancel := context.WithCancel(ctx)
-
-	http.HandleFunc("/", o.leaderHandler)
-	http.HandleFunc("/sse", o.sseHandler(ctx))
-
-	go func() {
-		o.Logger.Infof("Starting election service on %s", o.ElectionAddress)
-		err := http.ListenAndServe(o.ElectionAddress, nil)
-		o.Logger.Errorf("Failed to serve: %v", err)
-		cancel()
-	}()
-
-	return o.run(ctx)
-}
-
 func (o *official) run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case name := <-o.ElectionResults:
-			o.lastResult = result{
-				Name:       name,
+		case r := <-o.ElectionResults:
+			last := result{
+				Name:       r.Leader,
 				LastUpdate: time.Now().Format(time.RFC3339),
+				Epoch:      r.Epoch,
+				Slot:       r.Slot,
+				Holders:    r.Holders,
+				Pinned:     r.Pinned,
+				Frozen:     r.Frozen,
+				identity:   r.Identity,
 			}
-			for _, ch := range o.sseSubscribers {
-				ch <- o.lastResult
+			// Publish while holding the lock, so that watch sees either the old result and the update, or only the new result
+			o.lock.Lock()
+			o.lastResult = last
+			o.hub.publish(last)
+			o.lock.Unlock()
+
+			if o.updated != nil {
+				o.updated()
 			}
-			o.Logger.Debugf("Updated election results. Current leader: %s", name)
+			o.Logger.Debugf("Updated election results. Current leader: %s, epoch: %d", r.Leader, r.Epoch)
 		}
 	}
 }
 
-func AddOfficialToManager(mgr manager.Manager, logger logrus.FieldLogger, electionResults <-chan string, electionAddress string) error {
-	o := &official{
+// Election connects the results of a single election to the API.
+type Election struct {
+	Name    string
+	Results <-chan election.Result
+}
+
+// AddOfficialToManager adds the election API to the manager. The first election is also served on the
+// top level endpoints. Additional handlers are served on the same address. The gRPC API is served on
+// its own address, unless it is empty. Each election accepts up to maxSubscribers clients streaming or
+// waiting for results at once, or any number if it is zero.
+func AddOfficialToManager(mgr manager.Manager, logger logrus.FieldLogger, elections []Election, electionAddress, grpcAddress string, maxSubscribers int, handlers map[string]http.HandlerFunc) error {
+	if len(elections) == 0 {
+		return fmt.Errorf("at least one election is required")
+	}
+
+	s := &server{
 		Logger:          logger.WithField(logging.FieldComponent, "Manager"),
-		ElectionResults: electionResults,
 		ElectionAddress: electionAddress,
-		sseSubscribers:  make([]chan<- result, 0),
+		GRPCAddress:     grpcAddress,
+		Handlers:        handlers,
+		officials:       make(map[string]*official, len(elections)),
 	}
+	for _, e := range elections {
+		o := &official{
+			Logger:          s.Logger.WithField("election", e.Name),
+			ElectionResults: e.Results,
+			hub:             hub{max: maxSubscribers},
+			updated:         s.updateHealth,
+		}
+		s.names = append(s.names, e.Name)
+		s.officials[e.Name] = o
 
-	err := mgr.AddReadyzCheck("official", o.readyz)
-	if err != nil {
-		return fmt.Errorf("failed to add official readiness check to controller-runtime manager: %w", err)
+		err := mgr.AddReadyzCheck("official-"+e.Name, o.readyz)
+		if err != nil {
+			return fmt.Errorf("failed to add official readiness check to controller-runtime manager: %w", err)
+		}
 	}
 
-	err = mgr.Add(o)
+	err := mgr.Add(s)
 	if err != nil {
 		return fmt.Errorf("failed to add official runnable to controller-runtime manager: %w", err)
 	}
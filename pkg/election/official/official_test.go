@@ -4,11 +4,22 @@ import (
 	"context"
 	"fmt"
 	. "github.com/benjamintf1/unmarshalledmatchers"
+	"github.com/gorilla/websocket"
+	electorv1 "github.com/nais/elector/pkg/api/elector/v1"
+	"github.com/nais/elector/pkg/election"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 	"io"
+	"net"
 	"net/http/httptest"
+	"strings"
 	"time"
 )
 
@@ -16,7 +27,7 @@ var _ = Describe("Official", func() {
 	var ctx context.Context
 	var o *official
 	var logger logrus.FieldLogger
-	var electionResults chan string
+	var electionResults chan election.Result
 
 	BeforeEach(func() {
 		var cancel context.CancelFunc
@@ -24,7 +35,7 @@ var _ = Describe("Official", func() {
 		DeferCleanup(cancel)
 
 		logger = logrus.New()
-		electionResults = make(chan string)
+		electionResults = make(chan election.Result)
 		o = &official{
 			Logger:          logger,
 			ElectionResults: electionResults,
@@ -47,7 +58,7 @@ var _ = Describe("Official", func() {
 		})
 
 		It("should return initial election result", func() {
-			o.leaderHandler(w, nil)
+			o.leaderHandler(w, httptest.NewRequest("GET", "/", nil))
 
 			res := w.Result()
 			defer res.Body.Close()
@@ -59,10 +70,10 @@ var _ = Describe("Official", func() {
 		})
 
 		It("should return election result update", func() {
-			electionResults <- "new result"
+			electionResults <- election.Result{Leader: "new result", Epoch: 42}
 			time.Sleep(10 * time.Millisecond)
 
-			o.leaderHandler(w, nil)
+			o.leaderHandler(w, httptest.NewRequest("GET", "/", nil))
 
 			res := w.Result()
 			defer res.Body.Close()
@@ -70,7 +81,127 @@ var _ = Describe("Official", func() {
 			Expect(res.StatusCode).To(Equal(200))
 			Expect(res.Header.Get("Content-Type")).To(Equal("application/json"))
 			Expect(res.Header.Get("Cache-Control")).To(Equal("no-cache"))
-			Expect(io.ReadAll(res.Body)).To(ContainUnorderedJSON(`{"name":"new result"}`))
+			Expect(io.ReadAll(res.Body)).To(ContainUnorderedJSON(`{"name":"new result","epoch":42}`))
+		})
+
+		It("should return slot and holders in elections with several leaders", func() {
+			slot := 1
+			electionResults <- election.Result{Leader: "me", Epoch: 7, Slot: &slot, Holders: []string{"other", "me"}}
+			time.Sleep(10 * time.Millisecond)
+
+			o.leaderHandler(w, httptest.NewRequest("GET", "/", nil))
+
+			res := w.Result()
+			defer res.Body.Close()
+
+			Expect(res.StatusCode).To(Equal(200))
+			Expect(io.ReadAll(res.Body)).To(ContainUnorderedJSON(`{"name":"me","epoch":7,"slot":1,"holders":["other","me"]}`))
+		})
+	})
+
+	Context("long polling", func() {
+		var tag string
+
+		BeforeEach(func() {
+			o.lastResult = result{
+				Name:       "last result",
+				LastUpdate: "then",
+				Epoch:      7,
+			}
+			tag = o.lastResult.etag()
+		})
+
+		get := func(path, etag string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", path, nil)
+			if etag != "" {
+				r.Header.Set("If-None-Match", etag)
+			}
+			o.leaderHandler(w, r)
+			return w
+		}
+
+		It("should tag the result", func() {
+			w := get("/", "")
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Header().Get("ETag")).To(Equal(tag))
+		})
+
+		It("should change the tag with anything but the time of the last update", func() {
+			changed := o.lastResult
+			changed.LastUpdate = "now"
+			Expect(changed.etag()).To(Equal(tag))
+
+			changed.Holders = []string{"last result", "other"}
+			Expect(changed.etag()).ToNot(Equal(tag))
+
+			changed = o.lastResult
+			changed.Frozen = true
+			Expect(changed.etag()).ToNot(Equal(tag))
+		})
+
+		It("should return not modified for the current result", func() {
+			w := get("/", tag)
+			Expect(w.Code).To(Equal(304))
+			Expect(w.Header().Get("ETag")).To(Equal(tag))
+			Expect(w.Body.Len()).To(BeZero())
+
+			w = get("/", `"6", W/`+tag)
+			Expect(w.Code).To(Equal(304))
+
+			w = get("/", `"6"`)
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Body.String()).To(ContainUnorderedJSON(`{"name":"last result","epoch":7}`))
+		})
+
+		It("should wait for leadership to change", func() {
+			responses := make(chan *httptest.ResponseRecorder)
+			go func() {
+				responses <- get("/?wait=30s", tag)
+			}()
+			Consistently(responses, 50*time.Millisecond).ShouldNot(Receive())
+
+			electionResults <- election.Result{Leader: "new leader", Epoch: 8}
+			var w *httptest.ResponseRecorder
+			Eventually(responses).Should(Receive(&w))
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Header().Get("ETag")).ToNot(Equal(tag))
+			Expect(w.Body.String()).To(ContainUnorderedJSON(`{"name":"new leader","epoch":8}`))
+		})
+
+		It("should stop waiting when the election freezes", func() {
+			electionResults <- election.Result{Leader: "last result", Epoch: 7}
+			Eventually(func() string { return get("/", "").Header().Get("ETag") }).Should(Equal(tag))
+
+			responses := make(chan *httptest.ResponseRecorder)
+			go func() {
+				responses <- get("/?wait=30s", tag)
+			}()
+			Consistently(responses, 50*time.Millisecond).ShouldNot(Receive())
+
+			electionResults <- election.Result{Leader: "last result", Epoch: 7, Frozen: true}
+			var w *httptest.ResponseRecorder
+			Eventually(responses).Should(Receive(&w))
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Body.String()).To(ContainUnorderedJSON(`{"name":"last result","epoch":7,"frozen":true}`))
+		})
+
+		It("should return not modified when the wait is over", func() {
+			start := time.Now()
+			w := get("/?wait=50ms", tag)
+			Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+			Expect(w.Code).To(Equal(304))
+		})
+
+		It("should not wait when leadership has already changed", func() {
+			w := get("/?wait=30s", `"6"`)
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Body.String()).To(ContainUnorderedJSON(`{"name":"last result","epoch":7}`))
+		})
+
+		It("should reject invalid waits", func() {
+			Expect(get("/?wait=soon", tag).Code).To(Equal(400))
+			Expect(get("/?wait=-1s", tag).Code).To(Equal(400))
 		})
 	})
 
@@ -90,7 +221,7 @@ var _ = Describe("Official", func() {
 		})
 
 		It("should return initial election result", func() {
-			go o.sseHandler(ctx)(w, nil)
+			go o.sseHandler(ctx)(w, httptest.NewRequest("GET", "/sse", nil))
 			time.Sleep(10 * time.Millisecond)
 
 			line, err := w.Body.ReadString('\n')
@@ -101,7 +232,7 @@ var _ = Describe("Official", func() {
 		})
 
 		It("should continue to update election results", func() {
-			go o.sseHandler(ctx)(w, nil)
+			go o.sseHandler(ctx)(w, httptest.NewRequest("GET", "/sse", nil))
 			time.Sleep(10 * time.Millisecond)
 
 			line, err := w.Body.ReadString('\n')
@@ -112,7 +243,7 @@ var _ = Describe("Official", func() {
 			Expect(w.Body.ReadString('\n')).To(Equal("\n"))
 
 			for _, result := range []string{"first result", "second result", "third result"} {
-				electionResults <- result
+				electionResults <- election.Result{Leader: result}
 				time.Sleep(10 * time.Millisecond)
 
 				line, err := w.Body.ReadString('\n')
@@ -124,4 +255,295 @@ var _ = Describe("Official", func() {
 			}
 		})
 	})
+
+	Context("grpc api", func() {
+		var client electorv1.ElectionServiceClient
+		var healthClient healthpb.HealthClient
+
+		BeforeEach(func() {
+			o.lastResult = result{
+				Name:       "last result",
+				LastUpdate: "then",
+			}
+			s := &server{
+				Logger:    logger,
+				names:     []string{"first"},
+				officials: map[string]*official{"first": o},
+			}
+			o.updated = s.updateHealth
+
+			listener := bufconn.Listen(1024 * 1024)
+			grpcServer := s.grpcServer()
+			go func() {
+				_ = grpcServer.Serve(listener)
+			}()
+			DeferCleanup(grpcServer.Stop)
+
+			conn, err := grpc.NewClient("passthrough:///bufconn",
+				grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+					return listener.DialContext(ctx)
+				}),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(conn.Close)
+			client = electorv1.NewElectionServiceClient(conn)
+			healthClient = healthpb.NewHealthClient(conn)
+		})
+
+		It("should return the current result of the first election by default", func() {
+			r, err := client.GetLeader(ctx, &electorv1.GetLeaderRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetName()).To(Equal("last result"))
+			Expect(r.GetLastUpdate()).To(Equal("then"))
+
+			r, err = client.GetLeader(ctx, &electorv1.GetLeaderRequest{Election: "first"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetName()).To(Equal("last result"))
+		})
+
+		It("should return not found for unknown elections", func() {
+			_, err := client.GetLeader(ctx, &electorv1.GetLeaderRequest{Election: "unknown"})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+
+		It("should stream the current result and every update", func() {
+			stream, err := client.WatchLeader(ctx, &electorv1.WatchLeaderRequest{})
+			Expect(err).ToNot(HaveOccurred())
+
+			r, err := stream.Recv()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetName()).To(Equal("last result"))
+
+			slot := 1
+			electionResults <- election.Result{Leader: "new leader", Epoch: 42, Slot: &slot, Holders: []string{"other", "new leader"}}
+			r, err = stream.Recv()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetName()).To(Equal("new leader"))
+			Expect(r.GetEpoch()).To(Equal(int64(42)))
+			Expect(r.GetSlot()).To(Equal(int32(1)))
+			Expect(r.GetHolders()).To(Equal([]string{"other", "new leader"}))
+		})
+
+		It("should report health from readiness", func() {
+			service := electorv1.ElectionService_ServiceDesc.ServiceName
+			r, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetStatus()).To(Equal(healthpb.HealthCheckResponse_SERVING))
+
+			electionResults <- election.Result{}
+			Eventually(func() healthpb.HealthCheckResponse_ServingStatus {
+				r, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+				Expect(err).ToNot(HaveOccurred())
+				return r.GetStatus()
+			}).Should(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+		})
+	})
+
+	Context("role", func() {
+		var s *server
+
+		BeforeEach(func() {
+			s = &server{
+				Logger:    logger,
+				names:     []string{"first"},
+				officials: map[string]*official{"first": o},
+			}
+		})
+
+		get := func(path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			s.mux(ctx).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			return w
+		}
+
+		It("should be unavailable before the first election", func() {
+			w := get("/role")
+			Expect(w.Code).To(Equal(503))
+			Expect(w.Body.String()).To(MatchJSON(`{"is_leader":false,"identity":"","leader":""}`))
+		})
+
+		It("should follow leadership", func() {
+			role := func() string { return get("/role").Body.String() }
+
+			electionResults <- election.Result{Leader: "other", Identity: "me", Epoch: 1}
+			Eventually(role).Should(MatchJSON(`{"is_leader":false,"identity":"me","leader":"other"}`))
+			Expect(get("/role").Code).To(Equal(503))
+
+			electionResults <- election.Result{Leader: "me", Identity: "me", Epoch: 2}
+			Eventually(role).Should(MatchJSON(`{"is_leader":true,"identity":"me","leader":"me"}`))
+			Expect(get("/role").Code).To(Equal(200))
+			Expect(get("/elections/first/role").Code).To(Equal(200))
+			Expect(get("/elections/unknown/role").Code).To(Equal(404))
+
+			// The identity is only shown on /role
+			Expect(get("/").Body.String()).ToNot(ContainSubstring("identity"))
+		})
+
+		It("should never make observers leader", func() {
+			electionResults <- election.Result{Leader: "someone", Epoch: 1}
+			Eventually(func() string { return get("/role").Body.String() }).Should(MatchJSON(`{"is_leader":false,"identity":"","leader":"someone"}`))
+			Expect(get("/role").Code).To(Equal(503))
+		})
+	})
+
+	Context("multiple elections", func() {
+		var s *server
+		var other *official
+
+		BeforeEach(func() {
+			o.lastResult = result{
+				Name:       "first leader",
+				LastUpdate: "then",
+			}
+			other = &official{
+				Logger: logger,
+				lastResult: result{
+					Name:       "second leader",
+					LastUpdate: "then",
+				},
+			}
+			s = &server{
+				Logger: logger,
+				names:  []string{"first", "second"},
+				officials: map[string]*official{
+					"first":  o,
+					"second": other,
+				},
+			}
+		})
+
+		get := func(path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			s.mux(ctx).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			return w
+		}
+
+		It("should serve the first election on the top level endpoint", func() {
+			w := get("/")
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Body.String()).To(MatchJSON(`{"name":"first leader","last_update":"then"}`))
+		})
+
+		It("should serve each election by name", func() {
+			w := get("/elections/first")
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Body.String()).To(MatchJSON(`{"name":"first leader","last_update":"then"}`))
+
+			w = get("/elections/second")
+			Expect(w.Code).To(Equal(200))
+			Expect(w.Body.String()).To(MatchJSON(`{"name":"second leader","last_update":"then"}`))
+		})
+
+		It("should return not found for unknown elections", func() {
+			w := get("/elections/unknown")
+			Expect(w.Code).To(Equal(404))
+		})
+	})
+
+	Context("websocket api", func() {
+		var url string
+		var otherResults chan election.Result
+
+		BeforeEach(func() {
+			o.lastResult = result{
+				Name:       "first leader",
+				LastUpdate: "then",
+			}
+			otherResults = make(chan election.Result)
+			other := &official{
+				Logger:          logger,
+				ElectionResults: otherResults,
+				lastResult: result{
+					Name:       "second leader",
+					LastUpdate: "then",
+				},
+			}
+			go func(ctx context.Context) {
+				_ = other.run(ctx)
+			}(ctx)
+			s := &server{
+				Logger: logger,
+				names:  []string{"first", "second"},
+				officials: map[string]*official{
+					"first":  o,
+					"second": other,
+				},
+			}
+			httpServer := httptest.NewServer(s.mux(ctx))
+			DeferCleanup(httpServer.Close)
+			url = "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/ws"
+		})
+
+		dial := func(query string) *websocket.Conn {
+			conn, _, err := websocket.DefaultDialer.DialContext(ctx, url+query, nil)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(conn.Close)
+			return conn
+		}
+
+		read := func(conn *websocket.Conn) string {
+			Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			_, data, err := conn.ReadMessage()
+			Expect(err).ToNot(HaveOccurred())
+			return string(data)
+		}
+
+		It("should send the first election on connect and on every change", func() {
+			conn := dial("")
+			Expect(read(conn)).To(MatchJSON(`{"election":"first","name":"first leader","last_update":"then"}`))
+
+			electionResults <- election.Result{Leader: "new leader", Epoch: 42}
+			Expect(read(conn)).To(ContainUnorderedJSON(`{"election":"first","name":"new leader","epoch":42}`))
+		})
+
+		It("should send the elections given in the query", func() {
+			conn := dial("?election=second")
+			Expect(read(conn)).To(MatchJSON(`{"election":"second","name":"second leader","last_update":"then"}`))
+
+			otherResults <- election.Result{Leader: "new leader"}
+			Expect(read(conn)).To(ContainUnorderedJSON(`{"election":"second","name":"new leader"}`))
+		})
+
+		It("should refuse unknown elections in the query", func() {
+			_, res, err := websocket.DefaultDialer.DialContext(ctx, url+"?election=unknown", nil)
+			Expect(err).To(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(404))
+		})
+
+		It("should let clients subscribe and unsubscribe", func() {
+			conn := dial("")
+			Expect(read(conn)).To(ContainUnorderedJSON(`{"election":"first"}`))
+
+			Expect(conn.WriteJSON(map[string][]string{"subscribe": {"second"}, "unsubscribe": {"first"}})).To(Succeed())
+			Expect(read(conn)).To(ContainUnorderedJSON(`{"election":"second","name":"second leader"}`))
+
+			electionResults <- election.Result{Leader: "ignored"}
+			otherResults <- election.Result{Leader: "new leader"}
+			Expect(read(conn)).To(ContainUnorderedJSON(`{"election":"second","name":"new leader"}`))
+
+			Expect(conn.WriteJSON(map[string][]string{"subscribe": {"unknown"}})).To(Succeed())
+			Expect(read(conn)).To(MatchJSON(`{"election":"unknown","error":"no election named \"unknown\""}`))
+
+			Expect(conn.WriteMessage(websocket.TextMessage, []byte("nonsense"))).To(Succeed())
+			Expect(read(conn)).To(ContainSubstring(`"error"`))
+		})
+
+		It("should answer pings", func() {
+			conn := dial("")
+			Expect(read(conn)).To(ContainUnorderedJSON(`{"election":"first"}`))
+
+			pongs := make(chan string, 1)
+			conn.SetPongHandler(func(data string) error {
+				pongs <- data
+				return nil
+			})
+			Expect(conn.WriteControl(websocket.PingMessage, []byte("hello"), time.Now().Add(time.Second))).To(Succeed())
+
+			// The server answers the ping before reading the next request, and pongs are handled while reading
+			Expect(conn.WriteJSON(map[string][]string{"subscribe": {"second"}})).To(Succeed())
+			read(conn)
+			Expect(pongs).To(Receive(Equal("hello")))
+		})
+	})
 })
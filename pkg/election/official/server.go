@@ -0,0 +1,110 @@
+package official
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+)
+
+// server serves the API for all elections on a single address.
+type server struct {
+	Logger          logrus.FieldLogger
+	ElectionAddress string
+	GRPCAddress     string
+	Handlers        map[string]http.HandlerFunc
+
+	names     []string
+	officials map[string]*official
+	health    *health.Server
+	// healthLock serializes health updates from the officials, so an outdated status can't win
+	healthLock sync.Mutex
+}
+
+func (s *server) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mux := s.mux(ctx)
+
+	go func() {
+		s.Logger.Infof("Starting election service on %s", s.ElectionAddress)
+		err := http.ListenAndServe(s.ElectionAddress, mux)
+		s.Logger.Errorf("Failed to serve: %v", err)
+		cancel()
+	}()
+
+	if s.GRPCAddress != "" {
+		listener, err := net.Listen("tcp", s.GRPCAddress)
+		if err != nil {
+			return fmt.Errorf("unable to listen on %s: %w", s.GRPCAddress, err)
+		}
+		grpcServer := s.grpcServer()
+		go func() {
+			s.Logger.Infof("Starting gRPC election service on %s", s.GRPCAddress)
+			err := grpcServer.Serve(listener)
+			if err != nil {
+				s.Logger.Errorf("Failed to serve gRPC: %v", err)
+			}
+			cancel()
+		}()
+		go func() {
+			<-ctx.Done()
+			grpcServer.Stop()
+		}()
+	}
+
+	errs := make(chan error, len(s.officials))
+	for _, o := range s.officials {
+		go func() {
+			errs <- o.run(ctx)
+		}()
+	}
+	return <-errs
+}
+
+func (s *server) mux(ctx context.Context) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	first := s.officials[s.names[0]]
+	mux.HandleFunc("/", first.leaderHandler)
+	mux.HandleFunc("/sse", first.sseHandler(ctx))
+	mux.HandleFunc("GET /ws", s.wsHandler(ctx))
+	mux.HandleFunc("GET /role", first.roleHandler)
+
+	mux.HandleFunc("GET /elections/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if o := s.official(w, r); o != nil {
+			o.leaderHandler(w, r)
+		}
+	})
+	mux.HandleFunc("GET /elections/{name}/role", func(w http.ResponseWriter, r *http.Request) {
+		if o := s.official(w, r); o != nil {
+			o.roleHandler(w, r)
+		}
+	})
+	mux.HandleFunc("GET /elections/{name}/sse", func(w http.ResponseWriter, r *http.Request) {
+		if o := s.official(w, r); o != nil {
+			o.sseHandler(ctx)(w, r)
+		}
+	})
+
+	for pattern, handler := range s.Handlers {
+		mux.HandleFunc(pattern, handler)
+	}
+
+	return mux
+}
+
+// official finds the official for the election named in the request, and responds with 404 if there is none.
+func (s *server) official(w http.ResponseWriter, r *http.Request) *official {
+	o, ok := s.officials[r.PathValue("name")]
+	if !ok {
+		http.NotFound(w, r)
+		return nil
+	}
+	return o
+}
@@ -0,0 +1,212 @@
+package official
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 2 * wsPingInterval
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsMessage is sent to WebSocket clients. It is the result of an election, with the name of the election added,
+// or an error in response to a request.
+type wsMessage struct {
+	Election string `json:"election,omitempty"`
+	*result
+	Error string `json:"error,omitempty"`
+}
+
+// wsRequest is sent by WebSocket clients to change which elections they get results for.
+type wsRequest struct {
+	Subscribe   []string `json:"subscribe,omitempty"`
+	Unsubscribe []string `json:"unsubscribe,omitempty"`
+}
+
+// wsHandler serves election results over WebSocket. Clients start out subscribed to the elections given in the
+// election query parameter, or to the first election, and get the current result of each on connect and on every change.
+func (s *server) wsHandler(ctx context.Context) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		// Election results are readable without credentials over plain HTTP too, so any origin may read them
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		names := r.URL.Query()["election"]
+		if len(names) == 0 {
+			names = s.names[:1]
+		}
+		for _, name := range names {
+			if _, ok := s.officials[name]; !ok {
+				http.Error(w, fmt.Sprintf("no election named %q", name), http.StatusNotFound)
+				return
+			}
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already responded
+			s.Logger.Debugf("WebSocket upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		session := &wsSession{
+			server:        s,
+			conn:          conn,
+			updates:       make(chan wsMessage),
+			subscriptions: make(map[string]context.CancelFunc),
+		}
+		err = session.serve(ctx, names)
+		if err != nil {
+			s.Logger.Debugf("WebSocket connection closed: %v", err)
+		}
+	}
+}
+
+// wsSession is a single WebSocket connection. Everything is written from serve, while a separate goroutine reads.
+type wsSession struct {
+	server        *server
+	conn          *websocket.Conn
+	updates       chan wsMessage
+	subscriptions map[string]context.CancelFunc
+}
+
+func (ws *wsSession) serve(ctx context.Context, names []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	requests := ws.read(ctx)
+	for _, name := range names {
+		if err := ws.subscribe(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			deadline := time.Now().Add(wsWriteTimeout)
+			_ = ws.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), deadline)
+			return ctx.Err()
+		case <-ping.C:
+			if err := ws.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return err
+			}
+		case request, ok := <-requests:
+			if !ok {
+				return nil
+			}
+			if err := ws.handle(ctx, request); err != nil {
+				return err
+			}
+		case message := <-ws.updates:
+			// Results can be in flight when an election is unsubscribed
+			if _, ok := ws.subscriptions[message.Election]; !ok {
+				continue
+			}
+			if err := ws.write(message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// read reads requests from the client until the connection closes, which closes the returned channel.
+// Reading also handles pongs, which keep the connection alive, and answers pings from the client.
+func (ws *wsSession) read(ctx context.Context) <-chan wsRequest {
+	requests := make(chan wsRequest)
+
+	_ = ws.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	ws.conn.SetPongHandler(func(string) error {
+		return ws.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	go func() {
+		defer close(requests)
+		for {
+			_, data, err := ws.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var request wsRequest
+			if err = json.Unmarshal(data, &request); err != nil {
+				// An empty request gets an error back
+				request = wsRequest{}
+			}
+			select {
+			case requests <- request:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return requests
+}
+
+func (ws *wsSession) handle(ctx context.Context, request wsRequest) error {
+	if len(request.Subscribe) == 0 && len(request.Unsubscribe) == 0 {
+		return ws.write(wsMessage{Error: `requests should be JSON like {"subscribe": ["election"], "unsubscribe": ["election"]}`})
+	}
+	for _, name := range request.Unsubscribe {
+		if stop, ok := ws.subscriptions[name]; ok {
+			stop()
+			delete(ws.subscriptions, name)
+		}
+	}
+	for _, name := range request.Subscribe {
+		if err := ws.subscribe(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribe sends the current result of the election, and starts forwarding updates to it.
+func (ws *wsSession) subscribe(ctx context.Context, name string) error {
+	if _, ok := ws.subscriptions[name]; ok {
+		return nil
+	}
+	o, ok := ws.server.officials[name]
+	if !ok {
+		return ws.write(wsMessage{Election: name, Error: fmt.Sprintf("no election named %q", name)})
+	}
+
+	current, updates, stop, err := o.watch()
+	if err != nil {
+		return ws.write(wsMessage{Election: name, Error: err.Error()})
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ws.subscriptions[name] = cancel
+	go func() {
+		defer stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case r := <-updates:
+				select {
+				case ws.updates <- wsMessage{Election: name, result: &r}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ws.write(wsMessage{Election: name, result: &current})
+}
+
+func (ws *wsSession) write(message wsMessage) error {
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return ws.conn.WriteJSON(message)
+}
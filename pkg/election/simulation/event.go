@@ -0,0 +1,87 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Action is something that happens to the candidates during a simulation.
+type Action string
+
+const (
+	// ActionKill stops a candidate without releasing leadership, as when the process crashes. The Pod stays, but isn't ready.
+	ActionKill Action = "kill"
+	// ActionStop stops a candidate the way Kubernetes does, releasing leadership if configured to, and deletes its Pod.
+	ActionStop Action = "stop"
+	// ActionStart starts a candidate that was killed or stopped, or a new one if no target is given.
+	ActionStart Action = "start"
+	// ActionPartition cuts a candidate off from the API server. It keeps running, and keeps reporting what it last saw.
+	ActionPartition Action = "partition"
+	// ActionHeal ends a partition.
+	ActionHeal Action = "heal"
+	// ActionRollout replaces the running candidates one at a time, as a Deployment rollout does.
+	ActionRollout Action = "rollout"
+)
+
+// TargetLeader stands for whoever holds the lock when the event happens.
+const TargetLeader = "leader"
+
+// Event is an action scheduled at a time relative to the start of the simulation.
+type Event struct {
+	At     time.Duration
+	Action Action
+	// Target is the name of a candidate, or TargetLeader.
+	Target string
+	// Interval is the time between replacing each candidate in a rollout.
+	Interval time.Duration
+}
+
+// ParseEvent parses an event written as "<at> <action> [<target>]", such as "30s kill leader", "1m partition candidate-1"
+// or "2m rollout 20s", where a rollout takes the interval between candidates instead of a target.
+func ParseEvent(text string) (Event, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Event{}, fmt.Errorf("event %q should be \"<at> <action> [<target>]\"", text)
+	}
+	at, err := time.ParseDuration(fields[0])
+	if err != nil || at < 0 {
+		return Event{}, fmt.Errorf("event %q has an invalid time %q", text, fields[0])
+	}
+	event := Event{At: at, Action: Action(fields[1])}
+	if len(fields) == 3 {
+		event.Target = fields[2]
+	}
+
+	switch event.Action {
+	case ActionKill, ActionStop, ActionPartition, ActionHeal:
+		if event.Target == "" {
+			return Event{}, fmt.Errorf("event %q needs a target, either a candidate or %q", text, TargetLeader)
+		}
+	case ActionStart:
+		if event.Target == TargetLeader {
+			return Event{}, fmt.Errorf("event %q can't start the leader, as it is already running", text)
+		}
+	case ActionRollout:
+		interval, err := time.ParseDuration(event.Target)
+		if err != nil || interval <= 0 {
+			return Event{}, fmt.Errorf("event %q needs the interval between candidates, such as \"%s 20s\"", text, ActionRollout)
+		}
+		event.Target = ""
+		event.Interval = interval
+	default:
+		return Event{}, fmt.Errorf("event %q has an unknown action %q", text, event.Action)
+	}
+	return event, nil
+}
+
+func (e Event) String() string {
+	switch {
+	case e.Action == ActionRollout:
+		return fmt.Sprintf("%s every %v", e.Action, e.Interval)
+	case e.Target == "":
+		return string(e.Action)
+	default:
+		return fmt.Sprintf("%s %s", e.Action, e.Target)
+	}
+}
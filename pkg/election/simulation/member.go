@@ -0,0 +1,126 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	testclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/nais/elector/pkg/election"
+	"github.com/nais/elector/pkg/election/candidate"
+)
+
+// member is a candidate taking part in the simulation, along with what the simulation knows about it.
+type member struct {
+	name      string
+	index     int
+	candidate *candidate.Candidate
+	clock     *memberClock
+	ctx       context.Context
+	cancel    context.CancelFunc
+	results   chan election.Result
+	parked    chan time.Time
+	done      chan outcome
+	alive     bool
+	// deleted is set when the candidate's Pod is gone
+	deleted     bool
+	partitioned atomic.Bool
+
+	// belief is the leader the candidate last reported
+	belief string
+	// pending is when the candidate is next due to check the election, or zero if it isn't
+	pending time.Time
+	// wake is when a candidate that is waiting inside a check of the election continues, or zero if it isn't waiting
+	wake     time.Time
+	resyncAt time.Time
+	failures int
+}
+
+type outcome struct {
+	result ctrl.Result
+	err    error
+}
+
+func (m *member) leads() bool {
+	return m.alive && m.belief == m.name
+}
+
+// memberClock is a fake clock that tells the simulation when the candidate starts waiting for it.
+// The simulation then runs other candidates until the time is up, and moves the clock on.
+type memberClock struct {
+	*testclock.FakeClock
+	parked chan<- time.Time
+}
+
+func (c *memberClock) After(d time.Duration) <-chan time.Time {
+	ch := c.FakeClock.After(d)
+	c.parked <- c.Now().Add(d)
+	return ch
+}
+
+// memberClient is the candidate's connection to the API server, which fails while the candidate is partitioned.
+type memberClient struct {
+	client.Client
+	member *member
+}
+
+func (c *memberClient) reachable() error {
+	if c.member.partitioned.Load() {
+		return k8serrors.NewServiceUnavailable(fmt.Sprintf("%s is partitioned from the API server", c.member.name))
+	}
+	return nil
+}
+
+func (c *memberClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := c.reachable(); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *memberClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.reachable(); err != nil {
+		return err
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *memberClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.reachable(); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *memberClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.reachable(); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *memberClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.reachable(); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *memberClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.reachable(); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *memberClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := c.reachable(); err != nil {
+		return err
+	}
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
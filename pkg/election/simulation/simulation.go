@@ -0,0 +1,633 @@
+// Package simulation runs an election between in-process candidates against an in-memory API server, on a fake
+// clock, so that settings can be tried out against scripted failures before they are rolled out.
+package simulation
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordination_v1 "k8s.io/api/coordination/v1"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testclock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/nais/elector/pkg/election"
+	"github.com/nais/elector/pkg/election/backend"
+	"github.com/nais/elector/pkg/election/candidate"
+)
+
+const (
+	// LabelZone is the Node label set from Config.Zones.
+	LabelZone = "topology.kubernetes.io/zone"
+
+	// maxStepsPerInstant stops a simulation where candidates keep checking the election without time passing.
+	maxStepsPerInstant = 10000
+)
+
+type Config struct {
+	// Candidates is how many candidates are started at the beginning.
+	Candidates int
+	// Duration is how long to simulate.
+	Duration time.Duration
+	Events   []Event
+	// Priorities and Zones are given to the candidates' Pods and Nodes round robin, in the order the Pods are created.
+	Priorities []int
+	Zones      []string
+
+	// Candidate is the configuration of every candidate. Its backend, identity and namespace are set by the simulation.
+	Candidate candidate.Config
+	// NewBackend creates the lock backend for each candidate, on top of its connection to the API server.
+	NewBackend func(client.Client) backend.Backend
+	Election   types.NamespacedName
+	Logger     logrus.FieldLogger
+}
+
+type simulation struct {
+	Config
+	client   client.Client
+	backend  backend.Backend
+	start    time.Time
+	now      time.Time
+	members  []*member
+	events   []Event
+	timeline *Timeline
+
+	leadership   leadership
+	lockVersion  string
+	lockHolder   string
+	steps        int
+	lastInstant  time.Time
+	createdPods  int
+	reconcileFor reconcile.Request
+}
+
+// Run simulates the election, and returns a timeline of what happened.
+func Run(ctx context.Context, config Config) (*Timeline, error) {
+	s, err := newSimulation(config)
+	if err != nil {
+		return nil, err
+	}
+	defer s.stopAll()
+
+	for range s.Candidates {
+		if err = s.startMember(ctx, ""); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.observe(ctx); err != nil {
+		return nil, err
+	}
+
+	end := s.start.Add(s.Duration)
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		at, step := s.next()
+		if step == nil || at.After(end) {
+			break
+		}
+		if err = s.advance(at); err != nil {
+			return nil, err
+		}
+		if err = step(ctx); err != nil {
+			return nil, err
+		}
+		if err = s.observe(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	s.now = end
+	s.leadership.close(s.timeline, s.Duration)
+	return s.timeline, nil
+}
+
+func newSimulation(config Config) (*simulation, error) {
+	if config.Candidates < 1 {
+		return nil, fmt.Errorf("there must be at least one candidate")
+	}
+	if config.NewBackend == nil {
+		config.NewBackend = func(c client.Client) backend.Backend {
+			return backend.NewLease(c)
+		}
+	}
+	if config.Logger == nil {
+		config.Logger = logrus.New()
+	}
+
+	scheme := runtime.NewScheme()
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, zone := range config.Zones {
+		builder = builder.WithObjects(&core_v1.Node{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:   nodeName(zone),
+				Labels: map[string]string{LabelZone: zone},
+			},
+		})
+	}
+	apiServer := builder.Build()
+
+	events := slices.Clone(config.Events)
+	slices.SortStableFunc(events, byTime)
+
+	start := time.Now().Truncate(time.Second)
+	return &simulation{
+		Config:       config,
+		client:       apiServer,
+		backend:      config.NewBackend(apiServer),
+		start:        start,
+		now:          start,
+		events:       events,
+		timeline:     &Timeline{Duration: config.Duration, Summary: Summary{FirstLeader: -1}},
+		reconcileFor: reconcile.Request{NamespacedName: config.Election},
+	}, nil
+}
+
+func (s *simulation) elapsed() time.Duration {
+	return s.now.Sub(s.start)
+}
+
+// next finds what happens next: a scripted event, a candidate continuing after waiting, or a candidate checking the election.
+// Things that happen at the same time happen in that order.
+func (s *simulation) next() (time.Time, func(context.Context) error) {
+	var at time.Time
+	var step func(context.Context) error
+
+	consider := func(t time.Time, f func(context.Context) error) {
+		if !t.IsZero() && (step == nil || t.Before(at)) {
+			at, step = t, f
+		}
+	}
+
+	if len(s.events) > 0 {
+		event := s.events[0]
+		consider(s.start.Add(event.At), func(ctx context.Context) error {
+			s.events = s.events[1:]
+			return s.apply(ctx, event)
+		})
+	}
+	for _, m := range s.members {
+		if !m.alive {
+			continue
+		}
+		if !m.wake.IsZero() {
+			consider(m.wake, func(context.Context) error {
+				return s.resume(m)
+			})
+			continue
+		}
+		consider(m.pending, func(context.Context) error {
+			return s.reconcile(m)
+		})
+		consider(m.resyncAt, func(context.Context) error {
+			m.resyncAt = m.resyncAt.Add(s.Candidate.ResyncPeriod)
+			s.enqueue(m, s.now)
+			return nil
+		})
+	}
+	return at, step
+}
+
+// advance moves time on. Candidates waiting inside a check of the election keep their clock until they are resumed,
+// so that only one candidate runs at a time.
+func (s *simulation) advance(at time.Time) error {
+	if at.Equal(s.lastInstant) {
+		s.steps++
+		if s.steps > maxStepsPerInstant {
+			return fmt.Errorf("simulation is stuck at %v, candidates keep checking the election without time passing", s.elapsed())
+		}
+	} else {
+		s.lastInstant = at
+		s.steps = 0
+	}
+
+	s.now = at
+	for _, m := range s.members {
+		if m.alive && m.wake.IsZero() {
+			m.clock.SetTime(at)
+		}
+	}
+	return nil
+}
+
+// reconcile has the candidate check the election, as controller-runtime would when the Lease or a Pod changes.
+func (s *simulation) reconcile(m *member) error {
+	m.pending = time.Time{}
+	go func() {
+		result, err := m.candidate.Reconcile(m.ctx, s.reconcileFor)
+		m.done <- outcome{result: result, err: err}
+	}()
+	return s.wait(m)
+}
+
+func (s *simulation) resume(m *member) error {
+	m.wake = time.Time{}
+	m.clock.SetTime(s.now)
+	return s.wait(m)
+}
+
+// wait runs the candidate until it has finished checking the election, or waits for its clock.
+func (s *simulation) wait(m *member) error {
+	for {
+		select {
+		case result := <-m.results:
+			m.belief = result.Leader
+		case wake := <-m.parked:
+			m.wake = wake
+			return nil
+		case o := <-m.done:
+			s.schedule(m, o)
+			return nil
+		case <-time.After(time.Minute):
+			return fmt.Errorf("candidate %s hasn't finished checking the election after a minute of real time", m.name)
+		}
+	}
+}
+
+// schedule decides when the candidate checks the election again, the way controller-runtime does after a reconcile.
+func (s *simulation) schedule(m *member, o outcome) {
+	switch {
+	case m.ctx.Err() != nil:
+		return
+	case o.err != nil || (o.result.Requeue && o.result.RequeueAfter == 0):
+		m.failures++
+		s.enqueue(m, s.now.Add(s.backoff(m.failures)))
+	case o.result.RequeueAfter > 0:
+		m.failures = 0
+		s.enqueue(m, s.now.Add(o.result.RequeueAfter))
+	default:
+		m.failures = 0
+	}
+}
+
+// backoff follows the retry limiter of the candidates, without the jitter.
+func (s *simulation) backoff(failures int) time.Duration {
+	base, limit := s.Candidate.RetryBackoff, s.Candidate.RetryBackoffMax
+	if base <= 0 {
+		// The controller-runtime default
+		base, limit = 5*time.Millisecond, 1000*time.Second
+	}
+	delay := base
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+func (s *simulation) enqueue(m *member, at time.Time) {
+	if m.pending.IsZero() || at.Before(m.pending) {
+		m.pending = at
+	}
+}
+
+// enqueueAll has every candidate that can reach the API server check the election, as when it sees a change.
+func (s *simulation) enqueueAll() {
+	for _, m := range s.members {
+		if m.alive && !m.partitioned.Load() {
+			s.enqueue(m, s.now)
+		}
+	}
+}
+
+// observe looks at the lock and at what the candidates report, and records any changes in the timeline.
+func (s *simulation) observe(ctx context.Context) error {
+	lease, err := s.backend.Get(ctx, s.Election)
+	if err != nil {
+		return fmt.Errorf("unable to get lock: %w", err)
+	}
+	version, holder, epoch := "", "", ""
+	if lease != nil {
+		version = lease.ResourceVersion
+		holder = leaseHolder(lease)
+		epoch = lease.Annotations[backend.AnnotationEpoch]
+	}
+	if version != s.lockVersion {
+		s.lockVersion = version
+		s.enqueueAll()
+	}
+	if holder != s.lockHolder {
+		s.lockHolder = holder
+		if holder == "" {
+			s.timeline.add(s.elapsed(), "lock is free")
+		} else {
+			s.timeline.add(s.elapsed(), "lock is held by %s, epoch %s", holder, epoch)
+		}
+	}
+
+	leaders := make([]string, 0, 1)
+	for _, m := range s.members {
+		if m.leads() {
+			leaders = append(leaders, m.name)
+		}
+	}
+	s.leadership.change(s.timeline, s.elapsed(), leaders)
+	return nil
+}
+
+func (s *simulation) apply(ctx context.Context, event Event) error {
+	if event.Action == ActionRollout {
+		s.timeline.add(s.elapsed(), "%s", event)
+		s.rollout(event.Interval)
+		return nil
+	}
+	if event.Action == ActionStart {
+		// Starting is recorded as the candidate starts
+		if m := s.member(event.Target); event.Target != "" && m == nil {
+			s.timeline.add(s.elapsed(), "%s: no such candidate", event)
+			return nil
+		} else if m != nil && m.alive {
+			return nil
+		}
+		return s.startMember(ctx, event.Target)
+	}
+
+	m := s.member(event.Target)
+	switch {
+	case m == nil:
+		s.timeline.add(s.elapsed(), "%s: no such candidate", event)
+		return nil
+	case event.Target == TargetLeader:
+		s.timeline.add(s.elapsed(), "%s (%s)", event, m.name)
+	default:
+		s.timeline.add(s.elapsed(), "%s", event)
+	}
+
+	switch event.Action {
+	case ActionKill:
+		return s.kill(ctx, m)
+	case ActionStop:
+		return s.stop(ctx, m)
+	case ActionPartition:
+		m.partitioned.Store(true)
+	case ActionHeal:
+		m.partitioned.Store(false)
+		s.enqueue(m, s.now)
+	}
+	return nil
+}
+
+// member finds a candidate by name, or the one holding the lock.
+func (s *simulation) member(target string) *member {
+	if target == TargetLeader {
+		target = s.lockHolder
+	}
+	for i := len(s.members) - 1; i >= 0; i-- {
+		if s.members[i].name == target {
+			return s.members[i]
+		}
+	}
+	return nil
+}
+
+// rollout schedules replacing each running candidate in turn, starting the new one before stopping the old one.
+func (s *simulation) rollout(interval time.Duration) {
+	at := s.elapsed()
+	replacements := make([]Event, 0)
+	for _, m := range s.members {
+		if m.deleted {
+			continue
+		}
+		replacements = append(replacements,
+			Event{At: at, Action: ActionStart},
+			Event{At: at, Action: ActionStop, Target: m.name},
+		)
+		at += interval
+	}
+	s.events = append(replacements, s.events...)
+	slices.SortStableFunc(s.events, byTime)
+}
+
+// startMember starts a candidate with the given name, or a new one in a new Pod if the name is empty.
+func (s *simulation) startMember(ctx context.Context, name string) error {
+	var m *member
+	if name != "" {
+		m = s.member(name)
+	}
+	if m == nil {
+		m = &member{
+			name:    fmt.Sprintf("candidate-%d", s.createdPods),
+			index:   s.createdPods,
+			results: make(chan election.Result),
+			parked:  make(chan time.Time),
+			done:    make(chan outcome),
+		}
+		s.createdPods++
+		s.members = append(s.members, m)
+		s.timeline.add(s.elapsed(), "started %s", m.name)
+	} else {
+		s.timeline.add(s.elapsed(), "restarted %s", m.name)
+	}
+	m.deleted = false
+	if err := s.upsertPod(ctx, m); err != nil {
+		return err
+	}
+
+	client := &memberClient{Client: s.client, member: m}
+	config := s.Candidate
+	config.Backend = s.NewBackend(client)
+	config.IdentitySource = candidate.StaticIdentity{Name: m.name}
+	config.PodNamespace = s.Election.Namespace
+	// Waiting for a successor happens in real time, which would stall the simulation
+	config.SuccessorTimeout = 0
+
+	m.clock = &memberClock{FakeClock: testclock.NewFakeClock(s.now), parked: m.parked}
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	m.candidate = &candidate.Candidate{
+		Client:          client,
+		Config:          config,
+		Clock:           m.clock,
+		Logger:          s.Logger.WithField("candidate", m.name),
+		ElectionResults: m.results,
+		ElectionName:    s.Election,
+	}
+	m.alive = true
+	m.partitioned.Store(false)
+	m.belief = ""
+	m.failures = 0
+	m.wake = time.Time{}
+	m.pending = s.now
+	m.resyncAt = time.Time{}
+	if s.Candidate.ResyncPeriod > 0 {
+		m.resyncAt = s.now.Add(s.Candidate.ResyncPeriod)
+	}
+	s.enqueueAll()
+	return nil
+}
+
+// halt stops the candidate's process, interrupting it if it is waiting inside a check of the election.
+func (s *simulation) halt(m *member) error {
+	if !m.alive {
+		return nil
+	}
+	m.cancel()
+	if !m.wake.IsZero() {
+		m.wake = time.Time{}
+		if err := s.wait(m); err != nil {
+			return err
+		}
+	}
+	m.alive = false
+	m.pending = time.Time{}
+	return nil
+}
+
+// kill crashes the candidate. Its Pod stays, but is not ready, so a Lease in owner-reference mode stays too.
+func (s *simulation) kill(ctx context.Context, m *member) error {
+	if !m.alive {
+		return nil
+	}
+	if err := s.halt(m); err != nil {
+		return err
+	}
+	pod, err := s.pod(ctx, m)
+	if err != nil || pod == nil {
+		return err
+	}
+	setReady(pod, false, s.now)
+	s.enqueueAll()
+	return s.client.Update(ctx, pod)
+}
+
+// stop shuts the candidate down, releasing leadership if configured to, and deletes its Pod.
+// Like the garbage collector, it then deletes a lock owned by the Pod.
+func (s *simulation) stop(ctx context.Context, m *member) error {
+	if m.deleted {
+		return nil
+	}
+	running := m.alive
+	if err := s.halt(m); err != nil {
+		return err
+	}
+	if running && s.Candidate.ReleaseOnShutdown {
+		m.ctx, m.cancel = context.WithCancel(ctx)
+		go func() {
+			m.done <- outcome{err: m.candidate.Release(m.ctx)}
+		}()
+		if err := s.wait(m); err != nil {
+			return err
+		}
+		m.cancel()
+	}
+
+	pod, err := s.pod(ctx, m)
+	if err != nil || pod == nil {
+		return err
+	}
+	if err = s.client.Delete(ctx, pod); err != nil {
+		return err
+	}
+	m.deleted = true
+	s.enqueueAll()
+
+	lease, err := s.backend.Get(ctx, s.Election)
+	if err != nil || lease == nil {
+		return err
+	}
+	for _, owner := range lease.OwnerReferences {
+		if owner.UID == pod.UID {
+			return client.IgnoreNotFound(s.backend.Release(ctx, lease))
+		}
+	}
+	return nil
+}
+
+func (s *simulation) pod(ctx context.Context, m *member) (*core_v1.Pod, error) {
+	pod := &core_v1.Pod{}
+	err := s.client.Get(ctx, types.NamespacedName{Namespace: s.Election.Namespace, Name: m.name}, pod)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return pod, nil
+}
+
+// upsertPod makes sure the candidate has a ready Pod. A Pod that is already there has its containers restarted.
+func (s *simulation) upsertPod(ctx context.Context, m *member) error {
+	pod, err := s.pod(ctx, m)
+	if err != nil {
+		return err
+	}
+	if pod != nil {
+		setReady(pod, true, s.now)
+		for i := range pod.Status.ContainerStatuses {
+			pod.Status.ContainerStatuses[i].RestartCount++
+		}
+		return s.client.Update(ctx, pod)
+	}
+
+	pod = &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        m.name,
+			Namespace:   s.Election.Namespace,
+			UID:         uuid.NewUUID(),
+			Annotations: map[string]string{},
+		},
+		Status: core_v1.PodStatus{
+			ContainerStatuses: []core_v1.ContainerStatus{
+				{Name: s.Candidate.ContainerName},
+				{Name: "app"},
+			},
+		},
+	}
+	if len(s.Priorities) > 0 {
+		pod.Annotations[candidate.AnnotationPriority] = strconv.Itoa(s.Priorities[m.index%len(s.Priorities)])
+	}
+	if len(s.Zones) > 0 {
+		pod.Spec.NodeName = nodeName(s.Zones[m.index%len(s.Zones)])
+	}
+	setReady(pod, true, s.now)
+	return s.client.Create(ctx, pod)
+}
+
+// stopAll stops the candidates that are still running when the simulation ends.
+func (s *simulation) stopAll() {
+	for _, m := range s.members {
+		_ = s.halt(m)
+	}
+}
+
+func byTime(a, b Event) int {
+	return cmp.Compare(a.At, b.At)
+}
+
+func setReady(pod *core_v1.Pod, ready bool, now time.Time) {
+	status := core_v1.ConditionFalse
+	if ready {
+		status = core_v1.ConditionTrue
+	}
+	pod.Status.Conditions = []core_v1.PodCondition{{
+		Type:               core_v1.PodReady,
+		Status:             status,
+		LastTransitionTime: meta_v1.NewTime(now),
+	}}
+	for i := range pod.Status.ContainerStatuses {
+		pod.Status.ContainerStatuses[i].Ready = ready
+	}
+}
+
+func leaseHolder(lease *coordination_v1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func nodeName(zone string) string {
+	return "node-" + zone
+}
@@ -0,0 +1,113 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/nais/elector/pkg/election/candidate"
+)
+
+func simulationConfig(events ...string) Config {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	config := Config{
+		Candidates: 3,
+		Duration:   2 * time.Minute,
+		Candidate: candidate.Config{
+			Mode:              candidate.ModeRenewing,
+			LeaseDuration:     15 * time.Second,
+			RenewInterval:     5 * time.Second,
+			ReleaseOnShutdown: true,
+			ContainerName:     "elector",
+			RetryBackoff:      time.Second,
+			RetryBackoffMax:   time.Minute,
+			ResyncPeriod:      time.Minute,
+		},
+		Election: types.NamespacedName{Namespace: "default", Name: "simulation"},
+		Logger:   logger,
+	}
+	for _, text := range events {
+		event, err := ParseEvent(text)
+		if err != nil {
+			panic(err)
+		}
+		config.Events = append(config.Events, event)
+	}
+	return config
+}
+
+func TestParseEvent(t *testing.T) {
+	event, err := ParseEvent("30s kill leader")
+	require.NoError(t, err)
+	assert.Equal(t, Event{At: 30 * time.Second, Action: ActionKill, Target: TargetLeader}, event)
+
+	event, err = ParseEvent("1m30s rollout 20s")
+	require.NoError(t, err)
+	assert.Equal(t, Event{At: 90 * time.Second, Action: ActionRollout, Interval: 20 * time.Second}, event)
+
+	event, err = ParseEvent("10s start")
+	require.NoError(t, err)
+	assert.Equal(t, Event{At: 10 * time.Second, Action: ActionStart}, event)
+
+	for _, text := range []string{"", "30s", "soon kill leader", "30s kill", "30s explode leader", "30s rollout", "30s rollout leader", "30s start leader", "1s kill a b"} {
+		_, err = ParseEvent(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestRun_Steady(t *testing.T) {
+	timeline, err := Run(context.Background(), simulationConfig())
+	require.NoError(t, err)
+
+	assert.GreaterOrEqual(t, timeline.FirstLeader, time.Duration(0))
+	assert.Less(t, timeline.FirstLeader, time.Second)
+	assert.Equal(t, 0, timeline.Transitions)
+	assert.Equal(t, 0, timeline.Gaps)
+	assert.Equal(t, time.Duration(0), timeline.SplitBrainTime)
+}
+
+func TestRun_KillLeader(t *testing.T) {
+	timeline, err := Run(context.Background(), simulationConfig("30s kill leader"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, timeline.Transitions)
+	assert.Equal(t, 1, timeline.Gaps)
+	// The Lease was last renewed up to a renew interval before the kill, and expires a lease duration after that
+	assert.GreaterOrEqual(t, timeline.LongestGap, 10*time.Second)
+	assert.LessOrEqual(t, timeline.LongestGap, 15*time.Second)
+	assert.Equal(t, time.Duration(0), timeline.SplitBrainTime)
+}
+
+func TestRun_PartitionLeader(t *testing.T) {
+	timeline, err := Run(context.Background(), simulationConfig("30s partition candidate-0", "90s heal candidate-0"))
+	require.NoError(t, err)
+
+	// The partitioned leader stops reporting itself as leader when its Lease expires, which is when the next one takes over
+	assert.Equal(t, 1, timeline.Transitions)
+	assert.LessOrEqual(t, timeline.Gaps, 1)
+	assert.Equal(t, time.Duration(0), timeline.LongestGap)
+	assert.Equal(t, time.Duration(0), timeline.SplitBrainTime)
+}
+
+func TestRun_Rollout(t *testing.T) {
+	timeline, err := Run(context.Background(), simulationConfig("30s rollout 10s"))
+	require.NoError(t, err)
+
+	// Every candidate is replaced, and leaders release the Lease when stopped
+	assert.GreaterOrEqual(t, timeline.Transitions, 1)
+	assert.Less(t, timeline.LongestGap, time.Second)
+	assert.Equal(t, time.Duration(0), timeline.SplitBrainTime)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, timeline.Print(out))
+	assert.Contains(t, out.String(), "started candidate-5")
+	assert.Contains(t, out.String(), "stop candidate-2")
+}
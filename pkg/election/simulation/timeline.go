@@ -0,0 +1,110 @@
+package simulation
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Entry is something that happened during a simulation.
+type Entry struct {
+	At      time.Duration
+	Message string
+}
+
+// Summary sums up leadership over a simulation, as seen by the candidates themselves. A candidate leads when it
+// reports itself as leader to its application, which is what matters to applications, whatever the lock says.
+type Summary struct {
+	// FirstLeader is how long it took to elect the first leader, or negative if there never was one.
+	FirstLeader time.Duration
+	// Transitions counts how many times leadership moved to another candidate after the first leader.
+	Transitions int
+	// Gaps counts the periods without a leader after the first leader, which took LeaderlessTime in total.
+	Gaps           int
+	LeaderlessTime time.Duration
+	LongestGap     time.Duration
+	// SplitBrainTime is how long more than one candidate reported itself as leader.
+	SplitBrainTime time.Duration
+}
+
+// Timeline is the outcome of a simulation.
+type Timeline struct {
+	Duration time.Duration
+	Entries  []Entry
+	Summary
+}
+
+func (t *Timeline) add(at time.Duration, format string, args ...any) {
+	t.Entries = append(t.Entries, Entry{At: at, Message: fmt.Sprintf(format, args...)})
+}
+
+// Print writes the timeline and the summary in a form meant for people.
+func (t *Timeline) Print(w io.Writer) error {
+	b := strings.Builder{}
+	for _, entry := range t.Entries {
+		fmt.Fprintf(&b, "%10.3fs  %s\n", entry.At.Seconds(), entry.Message)
+	}
+
+	fmt.Fprintf(&b, "\nSummary of %v:\n", t.Duration)
+	if t.FirstLeader < 0 {
+		b.WriteString("  no leader was elected\n")
+	} else {
+		fmt.Fprintf(&b, "  first leader after  %v\n", t.FirstLeader)
+	}
+	fmt.Fprintf(&b, "  transitions         %d\n", t.Transitions)
+	fmt.Fprintf(&b, "  gaps                %d, %v in total, longest %v\n", t.Gaps, t.LeaderlessTime, t.LongestGap)
+	fmt.Fprintf(&b, "  split brain         %v\n", t.SplitBrainTime)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// leadership keeps track of who reports itself as leader over time, and sums it up.
+type leadership struct {
+	leaders []string
+	since   time.Duration
+	last    string
+	elected bool
+}
+
+// change records that the candidates reporting themselves as leader changed at the given time.
+func (l *leadership) change(t *Timeline, at time.Duration, leaders []string) {
+	if strings.Join(leaders, ",") == strings.Join(l.leaders, ",") {
+		return
+	}
+	l.close(t, at)
+	l.leaders = leaders
+	l.since = at
+
+	switch len(leaders) {
+	case 0:
+		t.add(at, "no leader")
+		if l.elected {
+			t.Gaps++
+		}
+	case 1:
+		t.add(at, "leader is %s", leaders[0])
+		if !l.elected {
+			l.elected = true
+			t.FirstLeader = at
+		} else if leaders[0] != l.last {
+			t.Transitions++
+		}
+		l.last = leaders[0]
+	default:
+		t.add(at, "split brain, leaders are %s", strings.Join(leaders, ", "))
+	}
+}
+
+// close accounts for the time since the last change.
+func (l *leadership) close(t *Timeline, at time.Duration) {
+	lasted := at - l.since
+	switch {
+	case len(l.leaders) == 0 && l.elected:
+		t.LeaderlessTime += lasted
+		t.LongestGap = max(t.LongestGap, lasted)
+	case len(l.leaders) > 1:
+		t.SplitBrainTime += lasted
+	}
+}
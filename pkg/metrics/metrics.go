@@ -8,6 +8,13 @@ const (
 	Namespace = "elector"
 
 	LabelResourceType = "resource_type"
+	LabelReason       = "reason"
+	LabelCampaign     = "campaign"
+	LabelElection     = "election"
+
+	// CampaignCreate is a campaign for a Lease that doesn't exist, and CampaignTakeover one for a Lease that has expired or is pinned.
+	CampaignCreate   = "create"
+	CampaignTakeover = "takeover"
 )
 
 var (
@@ -23,6 +30,36 @@ var (
 		Help:      "number of elections lost",
 	}, []string{})
 
+	PreemptionsRequested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "preemptions_requested",
+		Namespace: Namespace,
+		Help:      "number of times this candidate asked the leader to step down",
+	}, []string{})
+
+	CampaignAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "campaign_attempts",
+		Namespace: Namespace,
+		Help:      "number of times this candidate tried to become leader",
+	}, []string{LabelCampaign})
+
+	CampaignConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "campaign_conflicts",
+		Namespace: Namespace,
+		Help:      "number of campaigns lost because another candidate wrote the Lease first",
+	}, []string{LabelCampaign})
+
+	LeadersEvicted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "leaders_evicted",
+		Namespace: Namespace,
+		Help:      "number of unhealthy leaders evicted by this candidate",
+	}, []string{LabelReason})
+
+	ElectionsFrozen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "elections_frozen",
+		Namespace: Namespace,
+		Help:      "1 if the election is frozen because leadership changed hands too often, 0 otherwise",
+	}, []string{LabelElection})
+
 	KubernetesResourcesWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name:      "kubernetes_resources_written",
 		Namespace: Namespace,
@@ -35,5 +72,10 @@ func Register(registry prometheus.Registerer) {
 		KubernetesResourcesWritten,
 		ElectionsWon,
 		ElectionsLost,
+		PreemptionsRequested,
+		CampaignAttempts,
+		CampaignConflicts,
+		LeadersEvicted,
+		ElectionsFrozen,
 	)
 }